@@ -0,0 +1,462 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/heschmat/MemoBin/internal/highlight"
+	"github.com/heschmat/MemoBin/internal/models"
+)
+
+// The JSON API at /api/v1, for programs rather than browsers.
+// It authenticates with tokens (see `authenticateAPI`) instead of sessions, and every response is JSON:
+// on success the requested resources (e.g. `{"memo": {...}}`), otherwise an `apiErrorEnvelope`.
+
+// How a memo is represented in the API.
+type apiMemo struct {
+	Slug              string     `json:"slug"`
+	URL               string     `json:"url"` // of the memo's page
+	Title             string     `json:"title"`
+	Content           string     `json:"content,omitempty"` // only when a single memo is requested
+	Author            string     `json:"author"`
+	Created           time.Time  `json:"created"`
+	Updated           time.Time  `json:"updated"`
+	Expires           *time.Time `json:"expires"` // null if the memo never expires
+	Version           int        `json:"version"`
+	Visibility        string     `json:"visibility"`
+	BurnAfterReading  bool       `json:"burn_after_reading"`
+	PasswordProtected bool       `json:"password_protected"`
+	Tags              []string   `json:"tags"`
+	Language          string     `json:"language"`
+	Format            string     `json:"format"`
+}
+
+func newAPIMemo(r *http.Request, memo models.Memo, withContent bool) apiMemo {
+	m := apiMemo{
+		Slug:              memo.Slug,
+		URL:               fmt.Sprintf("%s/memo/view/%s", baseURL(r), memo.Slug),
+		Title:             memo.Title,
+		Author:            memo.Author,
+		Created:           memo.Created,
+		Updated:           memo.Updated,
+		Version:           memo.Version,
+		Visibility:        memo.Visibility,
+		BurnAfterReading:  memo.BurnAfterReading,
+		PasswordProtected: memo.HasPassword(),
+		Tags:              memo.Tags,
+		Language:          memo.Language,
+		Format:            memo.Format,
+	}
+	if withContent {
+		m.Content = memo.Content
+	}
+	if !memo.Expires.IsZero() {
+		m.Expires = &memo.Expires
+	}
+	// An empty list rather than null.
+	if m.Tags == nil {
+		m.Tags = []string{}
+	}
+	// Memos from before languages existed have none, i.e. they're plain text.
+	if m.Language == "" {
+		m.Language = highlight.Plaintext
+	}
+	return m
+}
+
+// The body of requests creating or updating a memo.
+type apiMemoInput struct {
+	Title   string `json:"title"`
+	Content string `json:"content"`
+	// One of `uploadExpiryOptions`; "7d" if it's empty. When updating, "keep" (the default) keeps the expiry date.
+	Expires string `json:"expires"`
+	// Only when creating: the password & burn after reading can't be changed later.
+	Password         string `json:"password"`
+	BurnAfterReading bool   `json:"burn_after_reading"`
+	// When updating, empty values (or no tags at all, as opposed to `[]`) keep the memo's current ones.
+	Visibility string   `json:"visibility"`
+	Tags       []string `json:"tags"`
+	Language   string   `json:"language"` // detected from the content if it's empty
+	Format     string   `json:"format"`
+	// Only when updating: the version the changes are based on; 0 overwrites whatever the current version is.
+	Version int `json:"version"`
+}
+
+// Turn the input into a memo form, which validates it the same way as the pages do.
+func (in apiMemoInput) form() memoCreateForm {
+	return memoCreateForm{
+		Title:            in.Title,
+		Content:          in.Content,
+		Expires:          in.Expires,
+		BurnAfterReading: in.BurnAfterReading,
+		Password:         in.Password,
+		Visibility:       in.Visibility,
+		Tags:             strings.Join(in.Tags, ","),
+		Language:         in.Language,
+		Format:           in.Format,
+		Version:          in.Version,
+	}
+}
+
+// The bodies of successful responses.
+type apiMemoEnvelope struct {
+	Memo apiMemo `json:"memo"`
+}
+
+type apiMemoListEnvelope struct {
+	Memos []apiMemo `json:"memos"`
+	// The cursors of the pages before & after this one, for the `cursor` parameter; omitted if there's no such page.
+	Prev string `json:"prev,omitempty"`
+	Next string `json:"next,omitempty"`
+}
+
+type apiUserEnvelope struct {
+	User apiUser `json:"user"`
+}
+
+// How a user is represented in the API.
+type apiUser struct {
+	ID      int       `json:"id"`
+	Name    string    `json:"name"`
+	Email   string    `json:"email"`
+	Created time.Time `json:"created"`
+}
+
+// The body of every error response, e.g.
+// `{"error": {"message": "Some fields are invalid", "fields": {"title": "This field cannot be blank"}}}`.
+type apiErrorEnvelope struct {
+	Error apiErrorBody `json:"error"`
+}
+
+type apiErrorBody struct {
+	Message string `json:"message"`
+	// Validation errors by field name (`validator.Validator.FieldErrors`); only for 422 responses.
+	Fields map[string]string `json:"fields,omitempty"`
+}
+
+// Send `data` as the JSON body of a response with the given status.
+func (app *application) writeJSON(w http.ResponseWriter, status int, data any) {
+	js, err := json.Marshal(data)
+	if err != nil {
+		// Only happens for types which can't be encoded at all, i.e., bugs.
+		app.logger.Error(err.Error(), "trace", string(debug.Stack()))
+		http.Error(w, `{"error": {"message": "Internal Server Error"}}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(append(js, '\n'))
+}
+
+// Send an error response; `message` is meant for people.
+func (app *application) apiError(w http.ResponseWriter, status int, message string) {
+	app.writeJSON(w, status, apiErrorEnvelope{Error: apiErrorBody{Message: message}})
+}
+
+// Send a 422 Unprocessable Entity response listing the invalid fields.
+func (app *application) apiFieldErrors(w http.ResponseWriter, fields map[string]string) {
+	app.writeJSON(w, http.StatusUnprocessableEntity, apiErrorEnvelope{Error: apiErrorBody{
+		Message: "Some fields are invalid",
+		Fields:  fields,
+	}})
+}
+
+// Log an unexpected error and send a 500 Internal Server Error response, like `serverError` does for pages.
+func (app *application) apiServerError(w http.ResponseWriter, r *http.Request, err error) {
+	app.logger.Error(err.Error(), "method", r.Method, "uri", r.URL.RequestURI(), "trace", string(debug.Stack()))
+	app.apiError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+}
+
+// Decode the JSON body of a request into `dst`.
+// Unknown fields are errors, so typos don't go unnoticed; the error messages are meant for the client
+// (e.g. "body must not be empty").
+func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst any) error {
+	// The same limit as the memo form.
+	r.Body = http.MaxBytesReader(w, r.Body, 4096)
+
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+
+	err := dec.Decode(dst)
+	if err != nil {
+		var syntaxError *json.SyntaxError
+		var typeError *json.UnmarshalTypeError
+		var maxBytesError *http.MaxBytesError
+
+		switch {
+		case errors.As(err, &syntaxError):
+			return fmt.Errorf("body contains badly-formed JSON (at character %d)", syntaxError.Offset)
+		case errors.Is(err, io.ErrUnexpectedEOF):
+			return errors.New("body contains badly-formed JSON")
+		case errors.As(err, &typeError):
+			return fmt.Errorf("body contains the wrong type for the field %q", typeError.Field)
+		case errors.Is(err, io.EOF):
+			return errors.New("body must not be empty")
+		case strings.HasPrefix(err.Error(), "json: unknown field "):
+			return fmt.Errorf("body contains the unknown field %s", strings.TrimPrefix(err.Error(), "json: unknown field "))
+		case errors.As(err, &maxBytesError):
+			return fmt.Errorf("body must not be larger than %d bytes", maxBytesError.Limit)
+		default:
+			return err
+		}
+	}
+
+	// A single JSON value only.
+	if dec.More() {
+		return errors.New("body must only contain a single JSON value")
+	}
+	return nil
+}
+
+// Look up the memo in the `{slug}` wildcard of the request path, like `memoFromPath` does for pages.
+// Private memos of other users don't exist, as far as the API is concerned.
+func (app *application) apiMemoFromPath(w http.ResponseWriter, r *http.Request) (memo models.Memo, ok bool) {
+	memo, err := app.memos.GetBySlug(r.PathValue("slug"))
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.apiError(w, http.StatusNotFound, "The memo doesn't exist")
+		} else {
+			app.apiServerError(w, r, err)
+		}
+		return models.Memo{}, false
+	}
+
+	if !memo.VisibleTo(app.authenticatedUserID(r)) {
+		app.apiError(w, http.StatusNotFound, "The memo doesn't exist")
+		return models.Memo{}, false
+	}
+
+	return memo, true
+}
+
+// Like `apiMemoFromPath`, but also requires the memo to belong to the authenticated user.
+func (app *application) apiOwnedMemoFromPath(w http.ResponseWriter, r *http.Request) (memo models.Memo, ok bool) {
+	memo, ok = app.apiMemoFromPath(w, r)
+	if !ok {
+		return models.Memo{}, false
+	}
+
+	if !memo.OwnedBy(app.authenticatedUserID(r)) {
+		app.apiError(w, http.StatusForbidden, "The memo belongs to someone else")
+		return models.Memo{}, false
+	}
+
+	return memo, true
+}
+
+// GET /api/v1/memos: the public memos, a page at a time, with the same filters as /memos
+// (e.g. `?tag=go&sort=title`). The content isn't included.
+func (app *application) apiMemoList(w http.ResponseWriter, r *http.Request) {
+	var form memoBrowseForm
+	err := app.formDecoder.Decode(&form, r.URL.Query())
+	if err != nil {
+		app.apiError(w, http.StatusBadRequest, "The query string is invalid")
+		return
+	}
+
+	filter := form.validate(time.Now())
+	if !form.Valid() {
+		app.apiFieldErrors(w, form.FieldErrors)
+		return
+	}
+
+	page, err := app.memos.List(filter)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidCursor) {
+			app.apiFieldErrors(w, map[string]string{"cursor": "This cursor is invalid"})
+		} else {
+			app.apiServerError(w, r, err)
+		}
+		return
+	}
+
+	memos := make([]apiMemo, len(page.Memos))
+	for i, memo := range page.Memos {
+		memos[i] = newAPIMemo(r, memo, false)
+	}
+
+	app.writeJSON(w, http.StatusOK, apiMemoListEnvelope{Memos: memos, Prev: page.Prev, Next: page.Next})
+}
+
+// GET /api/v1/memos/{slug}
+// Password-protected & burn-after-reading memos can only be read in the browser (except by their owner).
+func (app *application) apiMemoGet(w http.ResponseWriter, r *http.Request) {
+	memo, ok := app.apiMemoFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	if !memo.OwnedBy(app.authenticatedUserID(r)) {
+		if memo.HasPassword() {
+			app.apiError(w, http.StatusForbidden, "The memo is password-protected")
+			return
+		}
+		if memo.BurnAfterReading {
+			app.apiError(w, http.StatusForbidden, "The memo can only be read once, in the browser")
+			return
+		}
+	}
+
+	app.writeJSON(w, http.StatusOK, apiMemoEnvelope{Memo: newAPIMemo(r, memo, true)})
+}
+
+// POST /api/v1/memos
+func (app *application) apiMemoCreate(w http.ResponseWriter, r *http.Request) {
+	var input apiMemoInput
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.apiError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	form := input.form()
+	if form.Expires == "" {
+		form.Expires = "7d"
+	}
+	if form.Visibility == "" {
+		form.Visibility = models.VisibilityPublic
+	}
+
+	form.validate(uploadExpiryOptions...)
+	if !form.Valid() {
+		app.apiFieldErrors(w, form.FieldErrors)
+		return
+	}
+
+	opts := models.MemoOptions{
+		BurnAfterReading: form.BurnAfterReading,
+		Password:         form.Password,
+		Visibility:       form.Visibility,
+		Tags:             models.ParseTags(form.Tags),
+		Language:         form.language(),
+		Format:           form.Format,
+	}
+
+	slug, err := app.memos.Insert(app.authenticatedUserID(r), form.Title, form.Content, form.expiry(time.Time{}), opts)
+	if err != nil {
+		app.apiServerError(w, r, err)
+		return
+	}
+
+	memo, err := app.memos.GetBySlug(slug)
+	if err != nil {
+		app.apiServerError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Location", "/api/v1/memos/"+slug)
+	app.writeJSON(w, http.StatusCreated, apiMemoEnvelope{Memo: newAPIMemo(r, memo, true)})
+}
+
+// PUT /api/v1/memos/{slug}
+func (app *application) apiMemoUpdate(w http.ResponseWriter, r *http.Request) {
+	memo, ok := app.apiOwnedMemoFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	var input apiMemoInput
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.apiError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	form := input.form()
+	if form.Expires == "" {
+		form.Expires = expiresKeep
+	}
+	if form.Visibility == "" {
+		form.Visibility = memo.Visibility
+	}
+	if form.Format == "" {
+		form.Format = memo.Format
+	}
+	if input.Language == "" {
+		form.Language = memo.Language
+	}
+	if input.Tags == nil {
+		form.Tags = strings.Join(memo.Tags, ",")
+	}
+	if form.Version == 0 {
+		form.Version = memo.Version
+	}
+
+	form.validate(append(uploadExpiryOptions, expiresKeep)...)
+	form.CheckField(form.Password == "", "password", "The password can't be changed")
+	form.CheckField(!form.BurnAfterReading, "burn_after_reading", "Burn after reading can't be changed")
+	if !form.Valid() {
+		app.apiFieldErrors(w, form.FieldErrors)
+		return
+	}
+
+	opts := models.MemoOptions{Visibility: form.Visibility, Tags: models.ParseTags(form.Tags), Language: form.language(), Format: form.Format}
+
+	err = app.memos.Update(memo.ID, memo.UserID, form.Title, form.Content, form.expiry(memo.Expires), form.Version, opts)
+	if err != nil {
+		if errors.Is(err, models.ErrEditConflict) {
+			app.apiError(w, http.StatusConflict, "The memo has been changed since that version; fetch it again and retry")
+		} else if errors.Is(err, models.ErrNoRecord) {
+			app.apiError(w, http.StatusNotFound, "The memo doesn't exist")
+		} else {
+			app.apiServerError(w, r, err)
+		}
+		return
+	}
+
+	memo, err = app.memos.Get(memo.ID)
+	if err != nil {
+		app.apiServerError(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, apiMemoEnvelope{Memo: newAPIMemo(r, memo, true)})
+}
+
+// DELETE /api/v1/memos/{slug}: move the memo to the trash, like the delete button does.
+func (app *application) apiMemoDelete(w http.ResponseWriter, r *http.Request) {
+	memo, ok := app.apiOwnedMemoFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.memos.Delete(memo.ID, memo.UserID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.apiError(w, http.StatusNotFound, "The memo doesn't exist")
+		} else {
+			app.apiServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GET /api/v1/user: the user the token belongs to.
+func (app *application) apiUser(w http.ResponseWriter, r *http.Request) {
+	user, err := app.users.Get(app.authenticatedUserID(r))
+	if err != nil {
+		app.apiServerError(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, apiUserEnvelope{User: apiUser{
+		ID:      user.ID,
+		Name:    user.Name,
+		Email:   user.Email,
+		Created: user.Created,
+	}})
+}
+
+// Any other URL under /api/.
+func (app *application) apiNotFound(w http.ResponseWriter, r *http.Request) {
+	app.apiError(w, http.StatusNotFound, "There's no such endpoint")
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/heschmat/MemoBin/internal/assert"
+	"github.com/heschmat/MemoBin/internal/models"
+)
+
+// Send an API request with an optional token & JSON body, and decode the JSON response into `dst` (unless it's nil).
+// Every exchange is checked against the OpenAPI document too (see `checkContract`).
+func (ts *testServer) api(t *testing.T, method, urlPath, token, body string, dst any) (int, http.Header) {
+	req, err := http.NewRequest(method, ts.URL+urlPath, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	rs, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, header, b := readResponse(t, rs)
+
+	err = checkContract(method, urlPath, body, code, header, b)
+	if err != nil {
+		t.Errorf("the API diverges from its OpenAPI document: %v", err)
+	}
+
+	if dst != nil {
+		assert.Equal(t, header.Get("Content-Type"), "application/json")
+		err = json.Unmarshal([]byte(b), dst)
+		if err != nil {
+			t.Fatalf("%s %s: %v in %q", method, urlPath, err, b)
+		}
+	}
+	return code, header
+}
+
+// Create a user with a token for the API, which can read & write.
+func newAPIUser(t *testing.T, app *application, name string) (id int, token string) {
+	email := name + "@example.com"
+	err := app.users.Insert(name, email, "pa55word")
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err = app.users.Authenticate(email, "pa55word")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err = app.users.NewToken(id, "Test", models.ScopeWrite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id, token
+}
+
+func TestAPIMemos(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	aliceID, alice := newAPIUser(t, app, "alice")
+	bobID, bob := newAPIUser(t, app, "bob")
+	reader, err := app.users.NewToken(bobID, "Read-only", models.ScopeRead)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	private, err := app.memos.Insert(aliceID, "Private", "Secret", time.Time{}, models.MemoOptions{Visibility: models.VisibilityPrivate})
+	if err != nil {
+		t.Fatal(err)
+	}
+	locked, err := app.memos.Insert(aliceID, "Locked", "Secret", time.Time{}, models.MemoOptions{Password: "open sesame"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var slug string
+
+	t.Run("Create", func(t *testing.T) {
+		var res apiMemoEnvelope
+		code, header := ts.api(t, http.MethodPost, "/api/v1/memos", alice,
+			`{"title": "Shopping", "content": "- milk\n- eggs", "expires": "1d", "tags": ["food"], "format": "markdown"}`, &res)
+		assert.Equal(t, code, http.StatusCreated)
+
+		slug = res.Memo.Slug
+		assert.Equal(t, header.Get("Location"), "/api/v1/memos/"+slug)
+		assert.Equal(t, res.Memo.URL, ts.URL+"/memo/view/"+slug)
+		assert.Equal(t, res.Memo.Title, "Shopping")
+		assert.Equal(t, res.Memo.Content, "- milk\n- eggs")
+		assert.Equal(t, res.Memo.Author, "alice")
+		assert.Equal(t, res.Memo.Version, 1)
+		assert.Equal(t, res.Memo.Visibility, models.VisibilityPublic)
+		assert.Equal(t, strings.Join(res.Memo.Tags, ","), "food")
+		assert.Equal(t, res.Memo.Format, models.FormatMarkdown)
+		assert.Equal(t, res.Memo.Language, "markdown")
+		assert.Equal(t, res.Memo.Expires != nil && res.Memo.Expires.After(time.Now()), true)
+
+		// Empty values are the defaults, as far as the server & the OpenAPI document are concerned.
+		code, _ = ts.api(t, http.MethodPost, "/api/v1/memos", alice,
+			`{"title": "Defaults", "content": "x", "expires": "", "visibility": "", "language": "", "format": ""}`, &res)
+		assert.Equal(t, code, http.StatusCreated)
+		assert.Equal(t, res.Memo.Visibility, models.VisibilityPublic)
+		assert.Equal(t, res.Memo.Format, models.FormatPlain)
+	})
+
+	t.Run("Get", func(t *testing.T) {
+		tests := []struct {
+			name        string
+			urlPath     string
+			token       string
+			wantCode    int
+			wantTitle   string
+			wantMessage string
+		}{
+			{"Anonymous", "/api/v1/memos/" + slug, "", http.StatusOK, "Shopping", ""},
+			{"Private memo", "/api/v1/memos/" + private, bob, http.StatusNotFound, "", "The memo doesn't exist"},
+			{"Own private memo", "/api/v1/memos/" + private, alice, http.StatusOK, "Private", ""},
+			{"Password", "/api/v1/memos/" + locked, bob, http.StatusForbidden, "", "The memo is password-protected"},
+			{"Own password", "/api/v1/memos/" + locked, alice, http.StatusOK, "Locked", ""},
+			{"Non-existent slug", "/api/v1/memos/doesnotexist", "", http.StatusNotFound, "", "The memo doesn't exist"},
+			{"Invalid token", "/api/v1/memos/" + slug, alice + "x", http.StatusUnauthorized, "", "The token is invalid"},
+			{"Unknown endpoint", "/api/v1/nothing", "", http.StatusNotFound, "", "There's no such endpoint"},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				var res struct {
+					apiMemoEnvelope
+					apiErrorEnvelope
+				}
+				code, _ := ts.api(t, http.MethodGet, tt.urlPath, tt.token, "", &res)
+				assert.Equal(t, code, tt.wantCode)
+				assert.Equal(t, res.Memo.Title, tt.wantTitle)
+				assert.Equal(t, res.Error.Message, tt.wantMessage)
+			})
+		}
+	})
+
+	t.Run("List", func(t *testing.T) {
+		var res apiMemoListEnvelope
+		code, _ := ts.api(t, http.MethodGet, "/api/v1/memos?tag=food", "", "", &res)
+		assert.Equal(t, code, http.StatusOK)
+		assert.Equal(t, len(res.Memos), 1)
+		assert.Equal(t, res.Memos[0].Slug, slug)
+		// Listings don't include the content.
+		assert.Equal(t, res.Memos[0].Content, "")
+		assert.Equal(t, res.Next, "")
+
+		var errRes apiErrorEnvelope
+		code, _ = ts.api(t, http.MethodGet, "/api/v1/memos?sort=sideways", "", "", &errRes)
+		assert.Equal(t, code, http.StatusUnprocessableEntity)
+		assert.Equal(t, errRes.Error.Fields["sort"], "Please choose one of the listed options")
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		tests := []struct {
+			name        string
+			method      string
+			urlPath     string
+			token       string
+			body        string
+			wantCode    int
+			wantMessage string
+			wantFields  map[string]string
+		}{
+			{
+				name: "No token", method: http.MethodPost, urlPath: "/api/v1/memos", body: `{}`,
+				wantCode: http.StatusUnauthorized, wantMessage: "This requires a token",
+			},
+			{
+				name: "Read-only token", method: http.MethodPost, urlPath: "/api/v1/memos", token: reader, body: `{}`,
+				wantCode: http.StatusForbidden, wantMessage: "This requires a token with the write scope",
+			},
+			{
+				name: "Not JSON", method: http.MethodPost, urlPath: "/api/v1/memos", token: alice, body: `title=x`,
+				wantCode: http.StatusBadRequest, wantMessage: "body contains badly-formed JSON (at character 2)",
+			},
+			{
+				name: "Unknown field", method: http.MethodPost, urlPath: "/api/v1/memos", token: alice, body: `{"titel": "x"}`,
+				wantCode: http.StatusBadRequest, wantMessage: `body contains the unknown field "titel"`,
+			},
+			{
+				name: "Wrong type", method: http.MethodPost, urlPath: "/api/v1/memos", token: alice, body: `{"tags": "go"}`,
+				wantCode: http.StatusBadRequest, wantMessage: `body contains the wrong type for the field "tags"`,
+			},
+			{
+				name: "Invalid fields", method: http.MethodPost, urlPath: "/api/v1/memos", token: alice,
+				body:     `{"title": "", "content": "x", "expires": "custom", "tags": ["c++"]}`,
+				wantCode: http.StatusUnprocessableEntity, wantMessage: "Some fields are invalid",
+				wantFields: map[string]string{
+					"title":   "This field cannot be blank",
+					"expires": "Please choose one of the listed options",
+					"tags":    `"c++": tags can only contain letters, digits, - and _`,
+				},
+			},
+			{
+				name: "Someone else's memo", method: http.MethodPut, urlPath: "/api/v1/memos/" + slug, token: bob,
+				body:     `{"title": "Mine", "content": "x"}`,
+				wantCode: http.StatusForbidden, wantMessage: "The memo belongs to someone else",
+			},
+			{
+				name: "Changing the password", method: http.MethodPut, urlPath: "/api/v1/memos/" + slug, token: alice,
+				body:     `{"title": "Shopping", "content": "x", "password": "secret"}`,
+				wantCode: http.StatusUnprocessableEntity, wantMessage: "Some fields are invalid",
+				wantFields: map[string]string{"password": "The password can't be changed"},
+			},
+			{
+				name: "Deleting someone else's memo", method: http.MethodDelete, urlPath: "/api/v1/memos/" + slug, token: bob,
+				wantCode: http.StatusForbidden, wantMessage: "The memo belongs to someone else",
+			},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				var res apiErrorEnvelope
+				code, _ := ts.api(t, tt.method, tt.urlPath, tt.token, tt.body, &res)
+				assert.Equal(t, code, tt.wantCode)
+				assert.Equal(t, res.Error.Message, tt.wantMessage)
+				assert.Equal(t, len(res.Error.Fields), len(tt.wantFields))
+				for field, message := range tt.wantFields {
+					assert.Equal(t, res.Error.Fields[field], message)
+				}
+			})
+		}
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		// A language the user picked isn't detected again.
+		query, err := app.memos.Insert(aliceID, "Query", "SELECT 1;", time.Time{}, models.MemoOptions{Language: "python"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var res apiMemoEnvelope
+		code, _ := ts.api(t, http.MethodPut, "/api/v1/memos/"+query, alice, `{"title": "Renamed", "content": "SELECT 1 FROM memos;"}`, &res)
+		assert.Equal(t, code, http.StatusOK)
+		assert.Equal(t, res.Memo.Title, "Renamed")
+		assert.Equal(t, res.Memo.Language, "python")
+
+		code, _ = ts.api(t, http.MethodPut, "/api/v1/memos/"+slug, alice,
+			`{"title": "Groceries", "content": "- milk", "version": 1}`, &res)
+		assert.Equal(t, code, http.StatusOK)
+		assert.Equal(t, res.Memo.Title, "Groceries")
+		assert.Equal(t, res.Memo.Version, 2)
+		// Whatever isn't given is kept.
+		assert.Equal(t, strings.Join(res.Memo.Tags, ","), "food")
+		assert.Equal(t, res.Memo.Format, models.FormatMarkdown)
+		assert.Equal(t, res.Memo.Expires != nil, true)
+
+		// Based on an outdated version.
+		var errRes apiErrorEnvelope
+		code, _ = ts.api(t, http.MethodPut, "/api/v1/memos/"+slug, alice,
+			`{"title": "Food", "content": "- eggs", "version": 1}`, &errRes)
+		assert.Equal(t, code, http.StatusConflict)
+
+		code, _ = ts.api(t, http.MethodPut, "/api/v1/memos/"+slug, alice,
+			`{"title": "Food", "content": "- eggs", "tags": [], "expires": "never"}`, &res)
+		assert.Equal(t, code, http.StatusOK)
+		assert.Equal(t, res.Memo.Version, 3)
+		assert.Equal(t, len(res.Memo.Tags), 0)
+		assert.Equal(t, res.Memo.Expires == nil, true)
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		code, _ := ts.api(t, http.MethodDelete, "/api/v1/memos/"+slug, alice, "", nil)
+		assert.Equal(t, code, http.StatusNoContent)
+
+		var res apiErrorEnvelope
+		code, _ = ts.api(t, http.MethodGet, "/api/v1/memos/"+slug, "", "", &res)
+		assert.Equal(t, code, http.StatusNotFound)
+	})
+}
+
+func TestAPIUser(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	id, token := newAPIUser(t, app, "alice")
+
+	var res apiUserEnvelope
+	code, _ := ts.api(t, http.MethodGet, "/api/v1/user", token, "", &res)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, res.User.ID, id)
+	assert.Equal(t, res.User.Name, "alice")
+	assert.Equal(t, res.User.Email, "alice@example.com")
+
+	// A session doesn't authenticate API requests.
+	ts.login(t, app, "bob")
+	var errRes apiErrorEnvelope
+	code, header := ts.api(t, http.MethodGet, "/api/v1/user", "", "", &errRes)
+	assert.Equal(t, code, http.StatusUnauthorized)
+	assert.Equal(t, header.Get("WWW-Authenticate"), `Bearer realm="memobin"`)
+	assert.Equal(t, errRes.Error.Message, "This requires a token")
+}
@@ -0,0 +1,12 @@
+package main
+
+// Use a custom type for request context keys, so they can't collide
+// with keys set by third-party packages.
+type contextKey string
+
+// Set to `true` by the `authenticate` middleware when the session belongs
+// to a user that still exists in the database.
+const isAuthenticatedContextKey = contextKey("isAuthenticated")
+
+// The `models.Token` a request is authenticated with (see `requireToken`), rather than a session.
+const tokenContextKey = contextKey("token")
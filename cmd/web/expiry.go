@@ -0,0 +1,47 @@
+package main
+
+import (
+	"time"
+)
+
+// Expiry options offered when creating a memo, as durations from now.
+var expiryDurations = map[string]time.Duration{
+	"10m":  10 * time.Minute,
+	"1h":   time.Hour,
+	"1d":   24 * time.Hour,
+	"7d":   7 * 24 * time.Hour,
+	"365d": 365 * 24 * time.Hour,
+}
+
+// Expiry options besides the durations above.
+const (
+	expiresNever  = "never"
+	expiresCustom = "custom" // a date & time picked in the form (`expires_at`)
+	expiresKeep   = "keep"   // editing only: leave the expiry date as it is
+)
+
+// All expiry options for new memos.
+var expiryOptions = []string{"10m", "1h", "1d", "7d", "365d", expiresNever, expiresCustom}
+
+// The expiry options for memos uploaded from the command line, which can't pick a date.
+var uploadExpiryOptions = []string{"10m", "1h", "1d", "7d", "365d", expiresNever}
+
+// Layout of the value of an `<input type="datetime-local">`.
+// The browser doesn't send a time zone; the form asks for UTC.
+const datetimeLocalLayout = "2006-01-02T15:04"
+
+// Return the expiry date for a duration option (e.g. "1h") or "never", counting from `now`.
+// The zero time means the memo never expires. `ok` is false for unknown options.
+func expiryFromOption(option string, now time.Time) (expires time.Time, ok bool) {
+	if option == expiresNever {
+		return time.Time{}, true
+	}
+
+	d, ok := expiryDurations[option]
+	if !ok {
+		return time.Time{}, false
+	}
+
+	// Memos are stored with a precision of one second.
+	return now.UTC().Add(d).Truncate(time.Second), true
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/heschmat/MemoBin/internal/assert"
+)
+
+func TestExpiryFromOption(t *testing.T) {
+	now := time.Date(2025, 1, 10, 15, 3, 30, 500, time.UTC)
+
+	tests := []struct {
+		option string
+		want   time.Time
+		ok     bool
+	}{
+		{option: "10m", want: time.Date(2025, 1, 10, 15, 13, 30, 0, time.UTC), ok: true},
+		{option: "1h", want: time.Date(2025, 1, 10, 16, 3, 30, 0, time.UTC), ok: true},
+		{option: "7d", want: time.Date(2025, 1, 17, 15, 3, 30, 0, time.UTC), ok: true},
+		{option: "never", want: time.Time{}, ok: true},
+		{option: "2w", want: time.Time{}, ok: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.option, func(t *testing.T) {
+			got, ok := expiryFromOption(tt.option, now)
+			assert.Equal(t, got, tt.want)
+			assert.Equal(t, ok, tt.ok)
+		})
+	}
+}
@@ -1,13 +1,24 @@
 package main
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"maps"
+	"mime"
 	"net/http"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-playground/form/v4"
+	"github.com/heschmat/MemoBin/internal/diff"
+	"github.com/heschmat/MemoBin/internal/highlight"
+	"github.com/heschmat/MemoBin/internal/markdown"
 	"github.com/heschmat/MemoBin/internal/models"
+	"github.com/heschmat/MemoBin/internal/search"
 	"github.com/heschmat/MemoBin/internal/validator"
 )
 
@@ -19,10 +30,145 @@ type memoCreateForm struct {
 	// e.g., name "title" in the form matches with field "Title" in the struct.
 	Title                string `form:"title"`
 	Content              string `form:"content"`
-	Expires              int    `form:"expires"`
+	Expires              string `form:"expires"`    // one of `expiryOptions` (or "keep" when editing)
+	ExpiresAt            string `form:"expires_at"` // only used with the "custom" option
+	// Only used when editing: the version of the memo the form was loaded from.
+	Version              int    `form:"version"`
+	BurnAfterReading     bool   `form:"burn"`
+	Password             string `form:"password"`
+	Visibility           string `form:"visibility"`
+	Tags                 string `form:"tags"` // separated by commas or spaces
+	Language             string `form:"language"` // one of `highlight.Languages`; empty to detect it
+	Format               string `form:"format"`   // one of `models.Formats`
 	validator.Validator `form:"-"`
 }
 
+// Hold the form data for unlocking a password-protected memo.
+type memoUnlockForm struct {
+	Password            string `form:"password"`
+	validator.Validator `form:"-"`
+}
+
+// Validate the memo form fields.
+// The same rules apply when creating and editing a memo;
+// only the permitted values for `expires` differ.
+func (form *memoCreateForm) validate(permittedExpires ...string) {
+	form.CheckField(validator.NotBlank(form.Title), "title", "This field cannot be blank")
+	form.CheckField(validator.MaxChars(form.Title, 100), "title", "This field cannot be more than 100 chars long")
+	form.CheckField(validator.NotBlank(form.Content), "content", "This field cannot be blank.")
+	form.CheckField(validator.PermittedValue(form.Expires, permittedExpires...), "expires", "Please choose one of the listed options")
+	// Only where a date can be picked (not in uploads from the command line).
+	if form.Expires == expiresCustom && slices.Contains(permittedExpires, expiresCustom) {
+		expires, err := time.Parse(datetimeLocalLayout, form.ExpiresAt)
+		form.CheckField(err == nil, "expires_at", "Please enter a valid date and time")
+		form.CheckField(err != nil || expires.After(time.Now()), "expires_at", "This must be in the future")
+	}
+	form.CheckField(validator.PermittedValue(form.Visibility, models.Visibilities...), "visibility", "Please choose one of the listed options")
+	form.validateDisplay()
+	// The access password is optional.
+	if form.Password != "" {
+		form.CheckField(validator.MinChars(form.Password, 4), "password", "This field must be at least 4 characters long")
+		// bcrypt only uses the first 72 bytes.
+		form.CheckField(len(form.Password) <= 72, "password", "This field cannot be more than 72 bytes long")
+	}
+	tags := models.ParseTags(form.Tags)
+	form.CheckField(validator.MaxCount(tags, models.MaxTags), "tags", fmt.Sprintf("Please choose at most %d tags", models.MaxTags))
+	for _, tag := range tags {
+		form.CheckField(validator.MaxChars(tag, models.MaxTagLength), "tags", fmt.Sprintf("Tags cannot be more than %d chars long", models.MaxTagLength))
+		form.CheckField(validator.Matches(tag, validator.TagRX), "tags", fmt.Sprintf("%q: tags can only contain letters, digits, - and _", tag))
+	}
+}
+
+// Validate the fields deciding how the content is shown; the preview only needs these.
+func (form *memoCreateForm) validateDisplay() {
+	form.CheckField(form.Language == "" || validator.PermittedValue(form.Language, highlight.LanguageIDs()...), "language", "Please choose one of the listed options")
+	// Memos are plain text unless they're said to be something else.
+	if form.Format == "" {
+		form.Format = models.FormatPlain
+	}
+	form.CheckField(validator.PermittedValue(form.Format, models.Formats...), "format", "Please choose one of the listed options")
+}
+
+// Return the expiry date chosen in the (valid) form; the zero time means never.
+// `current` is the expiry date of the memo being edited, kept with the "keep" option.
+func (form *memoCreateForm) expiry(current time.Time) time.Time {
+	switch form.Expires {
+	case expiresKeep:
+		return current
+	case expiresCustom:
+		expires, _ := time.Parse(datetimeLocalLayout, form.ExpiresAt)
+		return expires
+	default:
+		expires, _ := expiryFromOption(form.Expires, time.Now())
+		return expires
+	}
+}
+
+// Return the language chosen in the (valid) form, or the one detected from the content if none was chosen.
+// Markdown memos are written in Markdown, unless the user says otherwise.
+func (form *memoCreateForm) language() string {
+	switch {
+	case form.Language != "":
+		return form.Language
+	case form.Format == models.FormatMarkdown:
+		return "markdown"
+	default:
+		return highlight.Detect(form.Content)
+	}
+}
+
+// Hold the filters of the memo listing at /memos.
+type memoBrowseForm struct {
+	Author              string `form:"author"`
+	From                string `form:"from"` // YYYY-MM-DD
+	To                  string `form:"to"`   // YYYY-MM-DD, inclusive
+	Expiring            bool   `form:"expiring"`
+	Tag                 string `form:"tag"`
+	Sort                string `form:"sort"` // one of `models.SortOrders`
+	Cursor              string `form:"cursor"`
+	validator.Validator `form:"-"`
+}
+
+// The layout of the dates in the browse form (as sent by `<input type="date">`).
+const dateLayout = "2006-01-02"
+
+// Validate the browse form and return the filter it describes, as of `now`.
+func (form *memoBrowseForm) validate(now time.Time) models.MemoFilter {
+	if form.Sort == "" {
+		form.Sort = models.SortNewest
+	}
+	form.CheckField(validator.PermittedValue(form.Sort, models.SortOrders...), "sort", "Please choose one of the listed options")
+
+	filter := models.MemoFilter{
+		Author: strings.TrimSpace(form.Author),
+		Tag:    strings.TrimPrefix(strings.ToLower(strings.TrimSpace(form.Tag)), "#"),
+		Sort:   form.Sort,
+		Cursor: form.Cursor,
+		Limit:  browsePageSize,
+	}
+
+	if form.From != "" {
+		from, err := time.Parse(dateLayout, form.From)
+		form.CheckField(err == nil, "from", "Please enter a valid date")
+		filter.CreatedFrom = from
+	}
+	if form.To != "" {
+		to, err := time.Parse(dateLayout, form.To)
+		form.CheckField(err == nil, "to", "Please enter a valid date")
+		// Up to the end of the day.
+		filter.CreatedUntil = to.AddDate(0, 0, 1)
+	}
+	if !filter.CreatedFrom.IsZero() && !filter.CreatedUntil.IsZero() {
+		form.CheckField(filter.CreatedFrom.Before(filter.CreatedUntil), "to", "This cannot be before the start date")
+	}
+
+	if form.Expiring {
+		filter.ExpiresBefore = now.Add(expiringSoon)
+	}
+
+	return filter
+}
+
 // Hold the form data for user auth:
 type userSignupForm struct {
 	Name                string `form:"name"`
@@ -31,21 +177,871 @@ type userSignupForm struct {
 	validator.Validator `form:"-"`
 }
 
-type userLoginForm struct {
-	Email               string `form:"email"`
-	Password            string `form:"password"`
+// Hold the form data for creating a personal access token.
+type tokenCreateForm struct {
+	Name                string `form:"name"`
+	Scope               string `form:"scope"` // one of `models.Scopes`
+	validator.Validator `form:"-"`
+}
+
+type userLoginForm struct {
+	Email               string `form:"email"`
+	Password            string `form:"password"`
+	validator.Validator `form:"-"`
+}
+
+
+// Test handler to introduce **testing HTTP handlers**
+// ping() handler returns a `200 OK` status code & a string response body "OK"
+func ping(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte("OK"))
+}
+
+func (app *application) home(w http.ResponseWriter, r *http.Request) {
+	page, err := app.memos.List(models.MemoFilter{Cursor: r.URL.Query().Get("cursor")})
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidCursor) {
+			app.clientError(w, http.StatusBadRequest)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Memos = page.Memos
+	data.Pagination = newPagination(r, page)
+	app.render(w, r, http.StatusOK, "home.tmpl.html", data)
+}
+
+// The memos shown per page at /memos, and how soon memos must expire to count as "expiring soon".
+const (
+	browsePageSize = 20
+	expiringSoon   = 24 * time.Hour
+)
+
+func (app *application) memoBrowse(w http.ResponseWriter, r *http.Request) {
+	// The filters come from the query string, so every page can be linked to.
+	var form memoBrowseForm
+	err := app.formDecoder.Decode(&form, r.URL.Query())
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	filter := form.validate(time.Now())
+
+	data := app.newTemplateData(r)
+	data.Form = form
+	if !form.Valid() {
+		app.render(w, r, http.StatusUnprocessableEntity, "browse.tmpl.html", data)
+		return
+	}
+
+	page, err := app.memos.List(filter)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidCursor) {
+			app.clientError(w, http.StatusBadRequest)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	data.Memos = page.Memos
+	data.Pagination = newPagination(r, page)
+	app.render(w, r, http.StatusOK, "browse.tmpl.html", data)
+}
+
+// How many results a search returns at most, and the length of their snippets (in characters).
+const (
+	searchLimit   = 50
+	snippetLength = 200
+)
+
+func (app *application) memoSearch(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	data.Search.Query = strings.TrimSpace(r.URL.Query().Get("q"))
+
+	if data.Search.Query != "" {
+		memos, err := app.memos.Search(data.Search.Query, app.authenticatedUserID(r), searchLimit)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		terms := search.Terms(data.Search.Query)
+		for _, memo := range memos {
+			data.Search.Results = append(data.Search.Results, searchResult{
+				Memo:    memo,
+				Title:   search.Highlight(memo.Title, terms),
+				Snippet: search.Snippet(memo.Content, terms, snippetLength),
+			})
+		}
+	}
+
+	app.render(w, r, http.StatusOK, "search.tmpl.html", data)
+}
+
+// List the memos with the tag in the `{name}` wildcard of the request path.
+func (app *application) tagView(w http.ResponseWriter, r *http.Request) {
+	// Tags are stored in lowercase, so `/tag/Go` shows the same memos as `/tag/go`.
+	tag := strings.ToLower(r.PathValue("name"))
+	// No memo can have a tag which isn't valid.
+	if !validator.Matches(tag, validator.TagRX) {
+		http.NotFound(w, r)
+		return
+	}
+
+	page, err := app.memos.List(models.MemoFilter{Tag: tag, Cursor: r.URL.Query().Get("cursor"), Limit: browsePageSize})
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidCursor) {
+			app.clientError(w, http.StatusBadRequest)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Tag = tag
+	data.Memos = page.Memos
+	data.Pagination = newPagination(r, page)
+	app.render(w, r, http.StatusOK, "tag.tmpl.html", data)
+}
+
+// How many tags are suggested at most while typing.
+const tagSuggestionLimit = 10
+
+// Suggest tags starting with the `q` query parameter, as a JSON array, for autocompletion in the memo form.
+func (app *application) tagSuggestions(w http.ResponseWriter, r *http.Request) {
+	tags, err := app.memos.Tags(strings.TrimPrefix(strings.TrimSpace(r.URL.Query().Get("q")), "#"), app.authenticatedUserID(r), tagSuggestionLimit)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	if tags == nil {
+		tags = []string{} // `[]` rather than `null`
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tags)
+}
+
+// Serve the stylesheet of a theme for highlighted code, e.g. /highlight/monokai.css.
+func (app *application) themeCSS(w http.ResponseWriter, r *http.Request) {
+	theme, ok := strings.CutSuffix(r.PathValue("file"), ".css")
+	if !ok || !validator.PermittedValue(theme, highlight.Themes...) {
+		http.NotFound(w, r)
+		return
+	}
+
+	css, err := highlight.CSS(theme)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/css; charset=utf-8")
+	// The stylesheets only change with the application.
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	w.Write(css)
+}
+
+// Hold the form data for choosing the theme of highlighted code.
+type themeForm struct {
+	Theme               string `form:"theme"`
+	Next                string `form:"next"` // where to go back to
+}
+
+// Remember the theme chosen for highlighted code, for the rest of the session.
+func (app *application) themePost(w http.ResponseWriter, r *http.Request) {
+	var form themeForm
+	err := app.decodePostForm(r, &form)
+	if err != nil || !validator.PermittedValue(form.Theme, highlight.Themes...) {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "theme", form.Theme)
+
+	// Only go back to pages of this site: "//example.com" would be another host.
+	next := form.Next
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		next = "/"
+	}
+	http.Redirect(w, r, next, http.StatusSeeOther)
+}
+
+func (app *application) about(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	app.render(w, r, http.StatusOK, "about.tmpl.html", data)
+}
+
+
+func (app *application) memoView(w http.ResponseWriter, r *http.Request) {
+	memo, ok := app.memoFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	// Password-protected memos need to be unlocked first.
+	if !app.isUnlocked(r, memo) {
+		data := app.newTemplateData(r)
+		data.Memo = models.Memo{ID: memo.ID, Slug: memo.Slug}
+		data.Form = memoUnlockForm{}
+		app.render(w, r, http.StatusOK, "unlock.tmpl.html", data)
+		return
+	}
+
+	// Burn-after-reading memos are only revealed (and deleted) once the reader confirms via POST.
+	// Link previews & crawlers only fetch the page, so they can't burn the memo by accident.
+	// The author can always look at their own memo.
+	if memo.BurnAfterReading && !memo.OwnedBy(app.authenticatedUserID(r)) {
+		data := app.newTemplateData(r)
+		// Don't leak anything but the ID before the memo is read.
+		data.Memo = models.Memo{ID: memo.ID, Slug: memo.Slug}
+		app.render(w, r, http.StatusOK, "burn.tmpl.html", data)
+		return
+	}
+
+	// No need anymore; we auto-display the flash msg. => helpers.go -> newTemplateData()
+	// flash := app.sessionManager.PopString(r.Context(), "flash")
+
+	data := app.newTemplateData(r)
+	data.Memo = memo
+	// data.Flash = flash // pass the `flash` message to the template
+	app.render(w, r, http.StatusOK, "view.tmpl.html", data)
+}
+
+// Serve the content of a memo as plain text, e.g. for `curl`.
+// Like every page showing the content, it's subject to the same checks as `memoView`:
+// password-protected & burn-after-reading memos redirect there.
+func (app *application) memoRaw(w http.ResponseWriter, r *http.Request) {
+	memo, ok := app.readableMemoFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	app.serveMemoContent(w, r, memo)
+}
+
+// Serve the content of a memo as a file to save, named after its title & language.
+func (app *application) memoDownload(w http.ResponseWriter, r *http.Request) {
+	memo, ok := app.readableMemoFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": downloadFilename(memo)}))
+	app.serveMemoContent(w, r, memo)
+}
+
+// Check the access password of a memo.
+// If it's correct, the memo stays unlocked for the rest of the session.
+func (app *application) memoUnlockPost(w http.ResponseWriter, r *http.Request) {
+	memo, ok := app.memoFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	if app.isUnlocked(r, memo) {
+		http.Redirect(w, r, fmt.Sprintf("/memo/view/%s", memo.Slug), http.StatusSeeOther)
+		return
+	}
+
+	var form memoUnlockForm
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	// Guessing is limited per memo, no matter who's guessing.
+	status := http.StatusUnprocessableEntity
+	if !app.unlockLimiter.Allow(memo.ID) {
+		form.AddNonFieldError("Too many failed attempts. Please try again later.")
+		status = http.StatusTooManyRequests
+	} else {
+		err = memo.CheckPassword(form.Password)
+		if err != nil {
+			if !errors.Is(err, models.ErrInvalidCredentials) {
+				app.serverError(w, r, err)
+				return
+			}
+			app.unlockLimiter.Fail(memo.ID)
+			form.AddFieldError("password", "Wrong password")
+		}
+	}
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Memo = models.Memo{ID: memo.ID, Slug: memo.Slug}
+		data.Form = form
+		app.render(w, r, status, "unlock.tmpl.html", data)
+		return
+	}
+
+	app.unlockLimiter.Reset(memo.ID)
+	app.sessionManager.Put(r.Context(), unlockedMemoKey(memo.ID), true)
+
+	http.Redirect(w, r, fmt.Sprintf("/memo/view/%s", memo.Slug), http.StatusSeeOther)
+}
+
+// The session key recording that a password-protected memo has been unlocked.
+func unlockedMemoKey(id int) string {
+	return fmt.Sprintf("unlockedMemo:%d", id)
+}
+
+// Report whether the content of `memo` may be shown as far as its password is concerned:
+// true if it has no password, belongs to the logged in user or was unlocked in this session.
+func (app *application) isUnlocked(r *http.Request, memo models.Memo) bool {
+	if !memo.HasPassword() || memo.OwnedBy(app.authenticatedUserID(r)) {
+		return true
+	}
+	return app.sessionManager.GetBool(r.Context(), unlockedMemoKey(memo.ID))
+}
+
+// Reveal a burn-after-reading memo, deleting it at the same time.
+func (app *application) memoBurnPost(w http.ResponseWriter, r *http.Request) {
+	memo, ok := app.memoFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	// The password comes first.
+	if !app.isUnlocked(r, memo) {
+		http.Redirect(w, r, fmt.Sprintf("/memo/view/%s", memo.Slug), http.StatusSeeOther)
+		return
+	}
+
+	// Only someone other than the author burns the memo.
+	if !memo.BurnAfterReading || memo.OwnedBy(app.authenticatedUserID(r)) {
+		http.Redirect(w, r, fmt.Sprintf("/memo/view/%s", memo.Slug), http.StatusSeeOther)
+		return
+	}
+
+	memo, err := app.memos.Burn(memo.ID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			// Somebody else read it first.
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	// This page can't be shown again, so make sure it isn't cached either.
+	w.Header().Set("Cache-Control", "no-store")
+
+	data := app.newTemplateData(r)
+	data.Memo = memo
+	data.Flash = "This memo has now been deleted. Copy anything you need: it can't be viewed again."
+	app.render(w, r, http.StatusOK, "view.tmpl.html", data)
+}
+
+func (app *application) memoCreate(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+
+	// Initialize a new `memoCreateForm` instance and pass it to the template.
+	// We also could set default values for the fields.
+	data.Form = memoCreateForm{
+		Expires:    "7d",
+		Visibility: models.VisibilityPublic,
+		Format:     models.FormatPlain,
+	}
+
+	app.render(w, r, http.StatusOK, "create.tmpl.html", data)
+}
+
+func (app *application) memoCreatePost(w http.ResponseWriter, r *http.Request) {
+	// Limit the request body size to 4096 bytes.
+	r.Body = http.MaxBytesReader(w, r.Body, 4096)
+	// if the limit above is hit, `MaxBytesreader` sets a flag on *http.ResponseWriter*
+	// which instructs the server to close the underlying TCP connection.
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	// // Get the `expires` value from the *form* as normal.
+	// expires, err := strconv.Atoi(r.PostForm.Get("expires"))
+	// if err != nil {
+	// 	app.clientError(w, http.StatusBadRequest)
+	// 	return
+	// }
+
+	// form := memoCreateForm {
+	// 	Title: r.PostForm.Get("title"),
+	// 	Content: r.PostForm.Get("content"),
+	// 	Expires: expires,
+	// }
+
+	var form memoCreateForm
+	// The follwoing will essentially fill the struct with the relevant values fro the HTML form.
+	// N.B. Type conversions are handled automatically too.
+	err = app.formDecoder.Decode(&form, r.PostForm)
+	if err != nil {
+		// If there's a problem, return a 400 Bad Request response to the client.
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.validate(expiryOptions...)
+
+	// If there are any validation errors,
+	// re-display the `create.tmpl.html` template, passing the `memoCreateForm` instance
+	// as dynamic data in the Form field.
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		// To indicate that there was a validation error, we use the HTTP status code 442.
+		app.render(w, r, http.StatusUnprocessableEntity, "create.tmpl.html", data)
+		return
+	}
+
+	// The memo belongs to whoever is logged in.
+	userID := app.authenticatedUserID(r)
+	if userID == 0 {
+		app.clientError(w, http.StatusForbidden)
+		return
+	}
+
+	opts := models.MemoOptions{
+		BurnAfterReading: form.BurnAfterReading,
+		Password:         form.Password,
+		Visibility:       form.Visibility,
+		Tags:             models.ParseTags(form.Tags),
+		Language:         form.language(),
+		Format:           form.Format,
+	}
+
+	slug, err := app.memos.Insert(userID, form.Title, form.Content, form.expiry(time.Time{}), opts)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// Add as string key:value - "flash":"Memo created successfully" to the session data.
+	// if - and only if - the *memo* is created successfully.
+	app.sessionManager.Put(r.Context(), "flash", "Memo created successfully.")
+
+	// Redirect the user to the relevant page for the memo.
+	http.Redirect(w, r, fmt.Sprintf("/memo/view/%s", slug), http.StatusSeeOther)
+}
+
+// Render the content of the memo form the way `memoView` would show it, for the preview tab of the form.
+// Only the content & the settings affecting how it's shown are needed; the response is an HTML fragment.
+func (app *application) memoPreviewPost(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, 4096)
+
+	var form memoCreateForm
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.validateDisplay()
+	if !form.Valid() {
+		app.clientError(w, http.StatusUnprocessableEntity)
+		return
+	}
+
+	// The same wrappers as in `view.tmpl.html`, so the preview is styled the same way.
+	var html string
+	if form.Format == models.FormatMarkdown {
+		html, err = markdown.Render(form.Content)
+		html = "<div class='markdown'>" + html + "</div>"
+	} else {
+		html, err = highlight.HTML(form.Content, form.language())
+		html = "<div class='code'>" + html + "</div>"
+	}
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(html))
+}
+
+// The most an upload from the command line can be: the same as the memo form,
+// so uploaded memos can still be edited in the browser.
+const maxUploadSize = 4096
+
+// Create a memo from the command line. The client authenticates with a token instead of a session
+// (see `requireToken`), and gets the URL of the new memo back as plain text:
+//
+//	curl -H "Authorization: Bearer $TOKEN" --data-binary @notes.txt https://memobin.example/
+//	cat build.log | curl -H "Authorization: Bearer $TOKEN" -F 'memo=<-' https://memobin.example/
+//
+// See `parseUploadForm` for the options.
+func (app *application) memoUploadPost(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
+
+	form, err := parseUploadForm(r)
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			app.clientError(w, http.StatusRequestEntityTooLarge)
+			return
+		}
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.validate(uploadExpiryOptions...)
+
+	// One line per invalid field, e.g. "expires: Please choose one of the listed options".
+	if !form.Valid() {
+		fields := slices.Sorted(maps.Keys(form.FieldErrors))
+		var b strings.Builder
+		for _, field := range fields {
+			fmt.Fprintf(&b, "%s: %s\n", field, form.FieldErrors[field])
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		w.Write([]byte(b.String()))
+		return
+	}
+
+	opts := models.MemoOptions{
+		Visibility: form.Visibility,
+		Language:   form.language(),
+		Format:     form.Format,
+	}
+
+	slug, err := app.memos.Insert(app.authenticatedUserID(r), form.Title, form.Content, form.expiry(time.Time{}), opts)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	url := fmt.Sprintf("%s/memo/view/%s", baseURL(r), slug)
+	w.Header().Set("Location", url)
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusCreated)
+	fmt.Fprintln(w, url)
+}
+
+// Read an upload from the command line into a memo form (which still needs validating).
+// The body is the content of the memo, unless it's a multipart form: then the content is its `memo` field,
+// either a value (`-F 'memo=<file'`) or a file (`-F memo=@file`), whose name is the default title.
+// The title, expiry & language are optional, and can be given as fields of the multipart form,
+// query parameters (e.g. `?expires=1d`) or headers (e.g. `X-Expires: 1d`), in that order of precedence.
+func parseUploadForm(r *http.Request) (memoCreateForm, error) {
+	form := memoCreateForm{
+		Title:      "Untitled",
+		Expires:    "7d",
+		Visibility: models.VisibilityPublic,
+		Format:     models.FormatPlain,
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "multipart/form-data" {
+		err := r.ParseMultipartForm(maxUploadSize)
+		if err != nil {
+			return form, err
+		}
+
+		file, header, err := r.FormFile("memo")
+		switch {
+		case err == nil:
+			defer file.Close()
+			content, err := io.ReadAll(file)
+			if err != nil {
+				return form, err
+			}
+			form.Content = string(content)
+			form.Title = header.Filename
+		case errors.Is(err, http.ErrMissingFile):
+			form.Content = r.PostFormValue("memo")
+		default:
+			return form, err
+		}
+	} else {
+		// Whatever the content type: `curl --data-binary` says it's a URL-encoded form, but it isn't.
+		content, err := io.ReadAll(r.Body)
+		if err != nil {
+			return form, err
+		}
+		form.Content = string(content)
+	}
+
+	option := func(name string, dst *string) {
+		for _, value := range []string{r.PostFormValue(name), r.URL.Query().Get(name), r.Header.Get("X-" + name)} {
+			if value != "" {
+				*dst = value
+				return
+			}
+		}
+	}
+	option("title", &form.Title)
+	option("expires", &form.Expires)
+	option("language", &form.Language)
+
+	return form, nil
+}
+
+func (app *application) memoEdit(w http.ResponseWriter, r *http.Request) {
+	memo, ok := app.ownedMemoFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Memo = memo
+	// Pre-fill the form with the current memo.
+	// The current expiry date is kept unless the user picks another option.
+	data.Form = memoCreateForm{
+		Title:      memo.Title,
+		Content:    memo.Content,
+		Expires:    expiresKeep,
+		Version:    memo.Version,
+		Visibility: memo.Visibility,
+		Tags:       strings.Join(memo.Tags, ", "),
+		Language:   memo.Language,
+		Format:     memo.Format,
+	}
+
+	app.render(w, r, http.StatusOK, "edit.tmpl.html", data)
+}
+
+func (app *application) memoEditPost(w http.ResponseWriter, r *http.Request) {
+	memo, ok := app.ownedMemoFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, 4096)
+
+	var form memoCreateForm
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.validate(append(expiryOptions, expiresKeep)...)
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Memo = memo
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "edit.tmpl.html", data)
+		return
+	}
+
+	// The tags are replaced by the ones in the form; none left means the memo has no tags anymore.
+	opts := models.MemoOptions{Visibility: form.Visibility, Tags: models.ParseTags(form.Tags), Language: form.language(), Format: form.Format}
+
+	err = app.memos.Update(memo.ID, memo.UserID, form.Title, form.Content, form.expiry(memo.Expires), form.Version, opts)
+	if err != nil {
+		if errors.Is(err, models.ErrEditConflict) {
+			// The memo was changed (e.g., in another tab) after this form was loaded.
+			// Show the latest version next to what the user submitted, so nothing gets lost.
+			app.memoEditConflict(w, r, memo.ID, form)
+		} else if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Memo updated successfully.")
+
+	http.Redirect(w, r, fmt.Sprintf("/memo/view/%s", memo.Slug), http.StatusSeeOther)
+}
+
+// Show all versions of a memo.
+func (app *application) memoHistory(w http.ResponseWriter, r *http.Request) {
+	memo, ok := app.readableMemoFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	revisions, err := app.memos.Revisions(memo)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Memo = memo
+	data.Revisions = revisions
+	app.render(w, r, http.StatusOK, "history.tmpl.html", data)
+}
+
+// Show a single (old) version of a memo.
+func (app *application) memoRevision(w http.ResponseWriter, r *http.Request) {
+	memo, ok := app.readableMemoFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	revision, ok := app.revisionFromRequest(w, r, memo, r.PathValue("version"))
+	if !ok {
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Memo = memo
+	data.Revision = revision
+	app.render(w, r, http.StatusOK, "revision.tmpl.html", data)
+}
+
+// Compare two versions of a memo: /memo/view/{id}/diff?from=1&to=2&mode=split
+// By default, the current version is compared with the one before it.
+func (app *application) memoDiff(w http.ResponseWriter, r *http.Request) {
+	memo, ok := app.readableMemoFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+
+	from := query.Get("from")
+	if from == "" {
+		from = strconv.Itoa(max(memo.Version-1, 1))
+	}
+	to := query.Get("to")
+	if to == "" {
+		to = strconv.Itoa(memo.Version)
+	}
+
+	fromRevision, ok := app.revisionFromRequest(w, r, memo, from)
+	if !ok {
+		return
+	}
+	toRevision, ok := app.revisionFromRequest(w, r, memo, to)
+	if !ok {
+		return
+	}
+
+	mode := query.Get("mode")
+	if !validator.PermittedValue(mode, "unified", "split") {
+		mode = "unified"
+	}
+
+	lines := diff.Lines(fromRevision.Content, toRevision.Content)
+
+	data := app.newTemplateData(r)
+	data.Memo = memo
+	data.Diff = diffData{
+		From:  fromRevision,
+		To:    toRevision,
+		Mode:  mode,
+		Hunks: diff.Hunks(lines, 3),
+		Rows:  diff.SideBySide(lines),
+	}
+	app.render(w, r, http.StatusOK, "diff.tmpl.html", data)
+}
+
+// Hold the form data for restoring an old version of a memo.
+type memoRestoreForm struct {
+	// The current version of the memo when the restore button was shown.
+	Version             int `form:"version"`
 	validator.Validator `form:"-"`
 }
 
+// Make an old version the current version of a memo.
+// The current version is kept in the history, like with any other edit.
+func (app *application) memoRestoreRevisionPost(w http.ResponseWriter, r *http.Request) {
+	memo, ok := app.ownedMemoFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	revision, ok := app.revisionFromRequest(w, r, memo, r.PathValue("version"))
+	if !ok {
+		return
+	}
 
-// Test handler to introduce **testing HTTP handlers**
-// ping() handler returns a `200 OK` status code & a string response body "OK"
-func ping(w http.ResponseWriter, r *http.Request) {
-	w.Write([]byte("OK"))
+	var form memoRestoreForm
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	// Only the content is restored; the expiry date & settings stay as they are.
+	err = app.memos.Update(memo.ID, memo.UserID, revision.Title, revision.Content, memo.Expires, form.Version, models.MemoOptions{})
+	if err != nil {
+		if errors.Is(err, models.ErrEditConflict) {
+			app.memoEditConflict(w, r, memo.ID, memoCreateForm{
+				Title:      revision.Title,
+				Content:    revision.Content,
+				Expires:    expiresKeep,
+				Version:    form.Version,
+				Visibility: memo.Visibility,
+				Tags:       strings.Join(memo.Tags, ", "),
+				Language:   memo.Language,
+				Format:     memo.Format,
+			})
+		} else if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("Version %d restored successfully.", revision.Version))
+
+	http.Redirect(w, r, fmt.Sprintf("/memo/view/%s", memo.Slug), http.StatusSeeOther)
 }
 
-func (app *application) home(w http.ResponseWriter, r *http.Request) {
-	memos, err := app.memos.Latest()
+// Look up a version of `memo`.
+// If there's no such version, a 404 response has already been sent and `ok` is false.
+func (app *application) revisionFromRequest(w http.ResponseWriter, r *http.Request, memo models.Memo, version string) (revision models.Revision, ok bool) {
+	v, err := strconv.Atoi(version)
+	if err != nil || v < 1 {
+		http.NotFound(w, r)
+		return models.Revision{}, false
+	}
+
+	revision, err = app.memos.Revision(memo, v)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return models.Revision{}, false
+	}
+
+	return revision, true
+}
+
+// Move a memo to its owner's trash.
+func (app *application) memoDeletePost(w http.ResponseWriter, r *http.Request) {
+	memo, ok := app.ownedMemoFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.memos.Delete(memo.ID, memo.UserID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Memo moved to the trash.")
+
+	http.Redirect(w, r, "/memo/trash", http.StatusSeeOther)
+}
+
+// Show the memos the logged in user has deleted.
+func (app *application) memoTrash(w http.ResponseWriter, r *http.Request) {
+	memos, err := app.memos.Trash(app.authenticatedUserID(r))
 	if err != nil {
 		app.serverError(w, r, err)
 		return
@@ -53,26 +1049,30 @@ func (app *application) home(w http.ResponseWriter, r *http.Request) {
 
 	data := app.newTemplateData(r)
 	data.Memos = memos
-	app.render(w, r, http.StatusOK, "home.tmpl.html", data)
+	app.render(w, r, http.StatusOK, "trash.tmpl.html", data)
 }
 
-func (app *application) about(w http.ResponseWriter, r *http.Request) {
-	data := app.newTemplateData(r)
-	app.render(w, r, http.StatusOK, "about.tmpl.html", data)
+func (app *application) memoTrashRestorePost(w http.ResponseWriter, r *http.Request) {
+	app.trashAction(w, r, app.memos.Restore, "Memo restored successfully.")
 }
 
+func (app *application) memoTrashPurgePost(w http.ResponseWriter, r *http.Request) {
+	app.trashAction(w, r, app.memos.Purge, "Memo deleted permanently.")
+}
 
-func (app *application) memoView(w http.ResponseWriter, r *http.Request) {
-	id, err := strconv.Atoi((r.PathValue("id")))
+// Apply `action` (restore or purge) to the memo in the `{id}` wildcard,
+// then return to the trash page.
+// Trashed memos are invisible to `memoFromPath`, so the model checks ownership itself.
+func (app *application) trashAction(w http.ResponseWriter, r *http.Request, action func(id, userID int) error, flash string) {
+	id, err := strconv.Atoi(r.PathValue("id"))
 	if err != nil || id < 1 {
 		http.NotFound(w, r)
 		return
 	}
 
-	memo, err := app.memos.Get(id)
+	err = action(id, app.authenticatedUserID(r))
 	if err != nil {
 		if errors.Is(err, models.ErrNoRecord) {
-			// If no matching record is found, return a 404 Not Found response.
 			http.NotFound(w, r)
 		} else {
 			app.serverError(w, r, err)
@@ -80,89 +1080,126 @@ func (app *application) memoView(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// No need anymore; we auto-display the flash msg. => helpers.go -> newTemplateData()
-	// flash := app.sessionManager.PopString(r.Context(), "flash")
+	app.sessionManager.Put(r.Context(), "flash", flash)
 
-	data := app.newTemplateData(r)
-	data.Memo = memo
-	// data.Flash = flash // pass the `flash` message to the template
-	app.render(w, r, http.StatusOK, "view.tmpl.html", data)
+	http.Redirect(w, r, "/memo/trash", http.StatusSeeOther)
 }
 
-func (app *application) memoCreate(w http.ResponseWriter, r *http.Request) {
-	data := app.newTemplateData(r)
-
-	// Initialize a new `memoCreateForm` instance and pass it to the template.
-	// We also could set default values for the fields.
-	data.Form = memoCreateForm{
-		Expires: 7,
+// Render the 409 Conflict page for a failed edit.
+func (app *application) memoEditConflict(w http.ResponseWriter, r *http.Request, id int, form memoCreateForm) {
+	// Re-read the memo to show its current state.
+	current, err := app.memos.Get(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
 	}
 
-	app.render(w, r, http.StatusOK, "create.tmpl.html", data)
+	data := app.newTemplateData(r)
+	data.Memo = current
+	data.Form = form
+	app.render(w, r, http.StatusConflict, "conflict.tmpl.html", data)
 }
 
-func (app *application) memoCreatePost(w http.ResponseWriter, r *http.Request) {
-	// Limit the request body size to 4096 bytes.
-	r.Body = http.MaxBytesReader(w, r.Body, 4096)
-	// if the limit above is hit, `MaxBytesreader` sets a flag on *http.ResponseWriter*
-	// which instructs the server to close the underlying TCP connection.
-	err := r.ParseForm()
+// Look up the memo whose slug is in the `{slug}` wildcard of the request path.
+// If there's no such memo (or the user isn't allowed to see it),
+// a response has already been sent and `ok` is false.
+func (app *application) memoFromPath(w http.ResponseWriter, r *http.Request) (memo models.Memo, ok bool) {
+	slug := r.PathValue("slug")
+
+	// Memos created before slugs were introduced were linked to by their numeric ID.
+	// Slugs are never all digits, so there's no ambiguity.
+	legacyID, err := strconv.Atoi(slug)
+	if err == nil {
+		app.redirectLegacyMemo(w, r, legacyID)
+		return models.Memo{}, false
+	}
+
+	memo, err = app.memos.GetBySlug(slug)
 	if err != nil {
-		app.clientError(w, http.StatusBadRequest)
-		return
+		if errors.Is(err, models.ErrNoRecord) {
+			// If no matching record is found, return a 404 Not Found response.
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return models.Memo{}, false
 	}
 
-	// // Get the `expires` value from the *form* as normal.
-	// expires, err := strconv.Atoi(r.PostForm.Get("expires"))
-	// if err != nil {
-	// 	app.clientError(w, http.StatusBadRequest)
-	// 	return
-	// }
+	// Private memos don't exist for anyone but their owner.
+	if !memo.VisibleTo(app.authenticatedUserID(r)) {
+		http.NotFound(w, r)
+		return models.Memo{}, false
+	}
 
-	// form := memoCreateForm {
-	// 	Title: r.PostForm.Get("title"),
-	// 	Content: r.PostForm.Get("content"),
-	// 	Expires: expires,
-	// }
+	return memo, true
+}
 
-	var form memoCreateForm
-	// The follwoing will essentially fill the struct with the relevant values fro the HTML form.
-	// N.B. Type conversions are handled automatically too.
-	err = app.formDecoder.Decode(&form, r.PostForm)
-	if err != nil {
-		// If there's a problem, return a 400 Bad Request response to the client.
-		app.clientError(w, http.StatusBadRequest)
+// Permanently redirect an old numeric memo URL (e.g. /memo/view/12/history) to its slug-based equivalent.
+func (app *application) redirectLegacyMemo(w http.ResponseWriter, r *http.Request, id int) {
+	// Only links can be redirected; forms are always rendered with slugs.
+	if r.Method != http.MethodGet || id < 1 {
+		http.NotFound(w, r)
 		return
 	}
 
-	form.CheckField(validator.NotBlank(form.Title), "title", "This field cannot be blank")
-	form.CheckField(validator.MaxChars(form.Title, 100), "title", "This field cannot be more than 100 chars long")
-	form.CheckField(validator.NotBlank(form.Content), "content", "This field cannot be blank.")
-	form.CheckField(validator.PermittedValue(form.Expires, 1, 7, 365), "expires", "Permitted values: 1, 7, 365")
-
-	// If there are any validation errors,
-	// re-display the `create.tmpl.html` template, passing the `memoCreateForm` instance
-	// as dynamic data in the Form field.
-	if !form.Valid() {
-		data := app.newTemplateData(r)
-		data.Form = form
-		// To indicate that there was a validation error, we use the HTTP status code 442.
-		app.render(w, r, http.StatusUnprocessableEntity, "create.tmpl.html", data)
+	memo, err := app.memos.GetByLegacyID(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
 		return
 	}
 
-	id, err := app.memos.Insert(form.Title, form.Content, form.Expires)
-	if err != nil {
-		app.serverError(w, r, err)
+	if !memo.VisibleTo(app.authenticatedUserID(r)) {
+		http.NotFound(w, r)
 		return
 	}
 
-	// Add as string key:value - "flash":"Memo created successfully" to the session data.
-	// if - and only if - the *memo* is created successfully.
-	app.sessionManager.Put(r.Context(), "flash", "Memo created successfully.")
+	// Replace the ID with the slug; it's the first path segment consisting of the ID.
+	u := *r.URL
+	u.Path = strings.Replace(u.Path, "/"+r.PathValue("slug"), "/"+memo.Slug, 1)
 
-	// Redirect the user to the relevant page for the memo.
-	http.Redirect(w, r, fmt.Sprintf("/memo/view/%d", id), http.StatusSeeOther)
+	http.Redirect(w, r, u.RequestURI(), http.StatusMovedPermanently)
+}
+
+// Like `memoFromPath`, for pages showing the content of a memo besides `memoView` (history, diffs, ...).
+// If `memoView` would hide the content behind an interstitial,
+// the user is redirected there instead and `ok` is false.
+func (app *application) readableMemoFromPath(w http.ResponseWriter, r *http.Request) (memo models.Memo, ok bool) {
+	memo, ok = app.memoFromPath(w, r)
+	if !ok {
+		return models.Memo{}, false
+	}
+
+	hidden := memo.BurnAfterReading && !memo.OwnedBy(app.authenticatedUserID(r))
+	if hidden || !app.isUnlocked(r, memo) {
+		http.Redirect(w, r, fmt.Sprintf("/memo/view/%s", memo.Slug), http.StatusSeeOther)
+		return models.Memo{}, false
+	}
+
+	return memo, true
+}
+
+// Like `memoFromPath`, but also requires the memo to belong to the logged in user.
+// Anybody else gets a 403 Forbidden response.
+func (app *application) ownedMemoFromPath(w http.ResponseWriter, r *http.Request) (memo models.Memo, ok bool) {
+	memo, ok = app.memoFromPath(w, r)
+	if !ok {
+		return models.Memo{}, false
+	}
+
+	if !memo.OwnedBy(app.authenticatedUserID(r)) {
+		app.clientError(w, http.StatusForbidden)
+		return models.Memo{}, false
+	}
+
+	return memo, true
 }
 
 // ============================================================================== #
@@ -275,7 +1312,15 @@ func (app *application) userLoginPost(w http.ResponseWriter, r *http.Request) {
 	// Add the ID of the current user to the session, so that they're now `logged in`
 	app.sessionManager.Put(r.Context(), "authenticatedUserID", id)
 
-	// Redirect the user to create a memo.
+	// If the user was sent to the login page by `requireAuthentication`,
+	// send them back to the page they originally asked for.
+	path := app.sessionManager.PopString(r.Context(), "redirectPathAfterLogin")
+	if strings.HasPrefix(path, "/") && !strings.HasPrefix(path, "//") {
+		http.Redirect(w, r, path, http.StatusSeeOther)
+		return
+	}
+
+	// Otherwise, redirect the user to create a memo.
 	http.Redirect(w, r, "/memo/create", http.StatusSeeOther)
 }
 
@@ -297,9 +1342,110 @@ func (app *application) userLogoutPost(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
 
+// Show the user's personal access tokens, with the form creating a new one.
+func (app *application) userTokens(w http.ResponseWriter, r *http.Request) {
+	app.renderTokens(w, r, http.StatusOK, tokenCreateForm{Scope: models.ScopeWrite}, "")
+}
+
+// Create a personal access token.
+// Only its hash is stored, so the page showing it is rendered right away (rather than after a redirect):
+// it can't be shown again.
+func (app *application) userTokensPost(w http.ResponseWriter, r *http.Request) {
+	var form tokenCreateForm
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	userID := app.authenticatedUserID(r)
+	tokens, err := app.users.Tokens(userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	form.Name = strings.TrimSpace(form.Name)
+	form.CheckField(validator.NotBlank(form.Name), "name", "This field cannot be blank")
+	form.CheckField(validator.MaxChars(form.Name, models.MaxTokenNameLength), "name", fmt.Sprintf("This field cannot be more than %d chars long", models.MaxTokenNameLength))
+	form.CheckField(validator.PermittedValue(form.Scope, models.Scopes...), "scope", "Please choose one of the listed options")
+	if len(tokens) >= models.MaxTokens {
+		form.AddNonFieldError(fmt.Sprintf("You can't have more than %d tokens; please revoke one first.", models.MaxTokens))
+	}
+
+	if !form.Valid() {
+		app.renderTokens(w, r, http.StatusUnprocessableEntity, form, "")
+		return
+	}
+
+	token, err := app.users.NewToken(userID, form.Name, form.Scope)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.renderTokens(w, r, http.StatusOK, tokenCreateForm{Scope: models.ScopeWrite}, token)
+}
+
+// Revoke one of the user's personal access tokens.
+func (app *application) userTokenRevokePost(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		http.NotFound(w, r)
+		return
+	}
+
+	err = app.users.RevokeToken(id, app.authenticatedUserID(r))
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Token revoked.")
+
+	http.Redirect(w, r, "/user/tokens", http.StatusSeeOther)
+}
+
+// Render the token page; `token` is a newly created token, to show once.
+func (app *application) renderTokens(w http.ResponseWriter, r *http.Request, status int, form tokenCreateForm, token string) {
+	tokens, err := app.users.Tokens(app.authenticatedUserID(r))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Form = form
+	data.Tokens = tokens
+	data.Token = token
+	data.BaseURL = baseURL(r)
+	app.render(w, r, status, "tokens.tmpl.html", data)
+}
+
 // If the request is from an authenticated user, return true.
+// N.B. The `authenticate` middleware must have run for the request.
 func (app *application) isAuthenticated(r *http.Request) bool {
-	return app.sessionManager.Exists(r.Context(), "authenticatedUserID")
+	isAuthenticated, ok := r.Context().Value(isAuthenticatedContextKey).(bool)
+	if !ok {
+		return false
+	}
+	return isAuthenticated
+}
+
+// Return the ID of the logged in user, or 0 if the request is anonymous.
+func (app *application) authenticatedUserID(r *http.Request) int {
+	if !app.isAuthenticated(r) {
+		return 0
+	}
+	// Requests authenticated with a token have no session.
+	if token, ok := r.Context().Value(tokenContextKey).(models.Token); ok {
+		return token.UserID
+	}
+	return app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
 }
 // ============================================================================== #
 
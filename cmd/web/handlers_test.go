@@ -2,12 +2,22 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"fmt"
+	"html"
 	"io"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/heschmat/MemoBin/internal/assert"
+	"github.com/heschmat/MemoBin/internal/models"
 )
 
 func TestPing(t *testing.T) {
@@ -38,3 +48,1401 @@ func TestPing(t *testing.T) {
 	body = bytes.TrimSpace(body)
 	assert.Equal(t, string(body), "OK")
 }
+
+func TestMemoView(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+
+	// The handlers only see the store through `models.MemoStore`, so we can fill it directly.
+	err := app.users.Insert("alice", "alice@example.com", "pa55word")
+	if err != nil {
+		t.Fatal(err)
+	}
+	public, err := app.memos.Insert(1, "A public memo", "Hello, world!", time.Time{}, models.MemoOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	private, err := app.memos.Insert(1, "A private memo", "Secret", time.Time{},
+		models.MemoOptions{Visibility: models.VisibilityPrivate})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+		wantBody string
+	}{
+		{"Public memo", "/memo/view/" + public, http.StatusOK, "Hello, world!"},
+		{"Private memo", "/memo/view/" + private, http.StatusNotFound, ""},
+		{"Non-existent slug", "/memo/view/doesnotexist", http.StatusNotFound, ""},
+		// Legacy IDs are redirected (see TestLegacyMemoURLs), but memos in this store don't have any.
+		{"Numeric ID", "/memo/view/1", http.StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, body := ts.get(t, tt.urlPath)
+
+			assert.Equal(t, code, tt.wantCode)
+			assert.Equal(t, strings.Contains(body, tt.wantBody), true)
+		})
+	}
+}
+
+func TestMemoCreate(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+
+	t.Run("Unauthenticated", func(t *testing.T) {
+		code, header, _ := ts.get(t, "/memo/create")
+
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, header.Get("Location"), "/user/login")
+	})
+
+	t.Run("Authenticated", func(t *testing.T) {
+		ts.login(t, app, "alice")
+
+		_, _, body := ts.get(t, "/memo/create")
+		form := url.Values{
+			"csrf_token": {extractCSRFToken(t, body)},
+			"title":      {"A new memo"},
+			"content":    {"Some content"},
+			"expires":    {"1d"},
+			"visibility": {models.VisibilityPublic},
+		}
+
+		code, header, _ := ts.postForm(t, "/memo/create", form)
+		assert.Equal(t, code, http.StatusSeeOther)
+
+		location := header.Get("Location")
+		assert.Equal(t, strings.HasPrefix(location, "/memo/view/"), true)
+
+		code, _, body = ts.get(t, location)
+		assert.Equal(t, code, http.StatusOK)
+		assert.Equal(t, strings.Contains(body, "A new memo"), true)
+	})
+
+	// Pages for logged in users aren't cached.
+	t.Run("Cache-Control", func(t *testing.T) {
+		code, header, _ := ts.get(t, "/memo/create")
+		assert.Equal(t, code, http.StatusOK)
+		assert.Equal(t, header.Get("Cache-Control"), "no-store")
+	})
+}
+
+func TestUserLogin(t *testing.T) {
+	app := newTestApplication(t)
+	err := app.users.Insert("alice", "alice@example.com", "pa55word")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Log in with the form, returning where the user is redirected to.
+	login := func(t *testing.T, ts *testServer) string {
+		_, _, body := ts.get(t, "/user/login")
+		form := url.Values{
+			"csrf_token": {extractCSRFToken(t, body)},
+			"email":      {"alice@example.com"},
+			"password":   {"pa55word"},
+		}
+		code, header, _ := ts.postForm(t, "/user/login", form)
+		assert.Equal(t, code, http.StatusSeeOther)
+		return header.Get("Location")
+	}
+
+	t.Run("Directly", func(t *testing.T) {
+		ts := newTestServer(t, app.routes())
+		assert.Equal(t, login(t, ts), "/memo/create")
+	})
+
+	t.Run("Back to the requested page", func(t *testing.T) {
+		ts := newTestServer(t, app.routes())
+		code, header, _ := ts.get(t, "/memo/trash?page=2")
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, header.Get("Location"), "/user/login")
+		assert.Equal(t, login(t, ts), "/memo/trash?page=2")
+
+		// Only once.
+		_, _, body := ts.get(t, "/memo/create")
+		code, _, _ = ts.postForm(t, "/user/logout", url.Values{"csrf_token": {extractCSRFToken(t, body)}})
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, login(t, ts), "/memo/create")
+	})
+
+	// Replaying a POST as a GET wouldn't do what the user wanted.
+	t.Run("Not after a POST", func(t *testing.T) {
+		ts := newTestServer(t, app.routes())
+		_, _, body := ts.get(t, "/user/login")
+		code, header, _ := ts.postForm(t, "/memo/preview", url.Values{"csrf_token": {extractCSRFToken(t, body)}})
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, header.Get("Location"), "/user/login")
+		assert.Equal(t, login(t, ts), "/memo/create")
+	})
+}
+
+func TestMemoSearch(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+
+	err := app.users.Insert("alice", "alice@example.com", "pa55word")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = app.memos.Insert(1, "Marmalade recipe", "Boil the oranges with sugar.", time.Time{}, models.MemoOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = app.memos.Insert(1, "Secret marmalade", "Don't tell.", time.Time{},
+		models.MemoOptions{Visibility: models.VisibilityPrivate})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		urlPath     string
+		wantBody    string
+		notWantBody string
+	}{
+		{"Match", "/memo/search?q=marmalade", "<mark>Marmalade</mark> recipe", "Secret"},
+		{"Snippet", "/memo/search?q=sugar", "with <mark>sugar</mark>.", ""},
+		{"No match", "/memo/search?q=toast", "No memos match", "Marmalade"},
+		{"No query", "/memo/search", "Enter some words", "Marmalade"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, body := ts.get(t, tt.urlPath)
+
+			assert.Equal(t, code, http.StatusOK)
+			assert.Equal(t, strings.Contains(body, tt.wantBody), true)
+			if tt.notWantBody != "" {
+				assert.Equal(t, strings.Contains(body, tt.notWantBody), false)
+			}
+		})
+	}
+
+	t.Run("Owner", func(t *testing.T) {
+		// Log in as alice, who is already signed up.
+		_, _, body := ts.get(t, "/user/login")
+		code, _, _ := ts.postForm(t, "/user/login", url.Values{
+			"csrf_token": {extractCSRFToken(t, body)},
+			"email":      {"alice@example.com"},
+			"password":   {"pa55word"},
+		})
+		assert.Equal(t, code, http.StatusSeeOther)
+
+		_, _, body = ts.get(t, "/memo/search?q=marmalade")
+		assert.Equal(t, strings.Contains(body, "<mark>marmalade</mark>"), true)
+		assert.Equal(t, strings.Contains(body, `value="marmalade"`), true)
+	})
+}
+
+var nextPageRX = regexp.MustCompile(`href="([^"]*)" class="next"`)
+
+// Extract the link to the next page from a listing; empty on the last page.
+func nextPage(body string) string {
+	matches := nextPageRX.FindStringSubmatch(body)
+	if matches == nil {
+		return ""
+	}
+	return html.UnescapeString(matches[1])
+}
+
+func TestMemoBrowse(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+
+	for _, name := range []string{"alice", "bob"} {
+		err := app.users.Insert(name, name+"@example.com", "pa55word")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 1; i <= 25; i++ {
+		_, err := app.memos.Insert(1, fmt.Sprintf("Memo %02d", i), "Content", time.Time{}, models.MemoOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err := app.memos.Insert(2, "Expiring memo", "Content", time.Now().Add(time.Hour), models.MemoOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("Pages", func(t *testing.T) {
+		code, _, body := ts.get(t, "/memos?sort=title")
+		assert.Equal(t, code, http.StatusOK)
+		assert.Equal(t, strings.Contains(body, "Expiring memo"), true)
+		assert.Equal(t, strings.Contains(body, "Memo 19"), true)
+		assert.Equal(t, strings.Contains(body, "Memo 20"), false)
+
+		next := nextPage(body)
+		assert.Equal(t, strings.HasPrefix(next, "/memos?"), true)
+		assert.Equal(t, strings.Contains(next, "sort=title"), true)
+
+		code, _, body = ts.get(t, next)
+		assert.Equal(t, code, http.StatusOK)
+		assert.Equal(t, strings.Contains(body, "Memo 20"), true)
+		assert.Equal(t, strings.Contains(body, "Memo 25"), true)
+		assert.Equal(t, strings.Contains(body, "Memo 19"), false)
+		assert.Equal(t, nextPage(body), "")
+	})
+
+	tests := []struct {
+		name        string
+		urlPath     string
+		wantCode    int
+		wantBody    string
+		notWantBody string
+	}{
+		{"Author", "/memos?author=bob", http.StatusOK, "Expiring memo", "Memo 01"},
+		{"Expiring soon", "/memos?expiring=true", http.StatusOK, "Expiring memo", "Memo 01"},
+		{"Date range", "/memos?from=2000-01-01&to=2000-12-31", http.StatusOK, "No memos match", "Memo 01"},
+		{"Invalid date", "/memos?from=yesterday", http.StatusUnprocessableEntity, "Please enter a valid date", "Memo 01"},
+		{"Reversed dates", "/memos?from=2000-12-31&to=2000-01-01", http.StatusUnprocessableEntity, "cannot be before", ""},
+		{"Invalid sort", "/memos?sort=random", http.StatusUnprocessableEntity, "Please choose", ""},
+		{"Invalid cursor", "/memos?cursor=nonsense", http.StatusBadRequest, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, body := ts.get(t, tt.urlPath)
+
+			assert.Equal(t, code, tt.wantCode)
+			assert.Equal(t, strings.Contains(body, tt.wantBody), true)
+			if tt.notWantBody != "" {
+				assert.Equal(t, strings.Contains(body, tt.notWantBody), false)
+			}
+		})
+	}
+
+	t.Run("Home", func(t *testing.T) {
+		_, _, body := ts.get(t, "/")
+		assert.Equal(t, strings.Contains(body, "Expiring memo"), true)
+		assert.Equal(t, strings.Contains(body, "Memo 17"), true)
+		assert.Equal(t, strings.Contains(body, "Memo 16"), false)
+
+		next := nextPage(body)
+		assert.Equal(t, strings.HasPrefix(next, "/?cursor="), true)
+
+		_, _, body = ts.get(t, next)
+		assert.Equal(t, strings.Contains(body, "Memo 16"), true)
+		assert.Equal(t, strings.Contains(body, "Memo 17"), false)
+	})
+}
+
+func TestTags(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	ts.login(t, app, "alice")
+
+	create := func(t *testing.T, title, tags string) (int, string, string) {
+		_, _, body := ts.get(t, "/memo/create")
+		form := url.Values{
+			"csrf_token": {extractCSRFToken(t, body)},
+			"title":      {title},
+			"content":    {"Some content"},
+			"expires":    {"1d"},
+			"visibility": {models.VisibilityPublic},
+			"tags":       {tags},
+		}
+
+		code, header, body := ts.postForm(t, "/memo/create", form)
+		return code, header.Get("Location"), body
+	}
+
+	t.Run("Create", func(t *testing.T) {
+		code, location, _ := create(t, "Tagged memo", "#Go, web-dev go")
+		assert.Equal(t, code, http.StatusSeeOther)
+
+		_, _, body := ts.get(t, location)
+		assert.Equal(t, strings.Contains(body, `<a href="/tag/go" class="tag">#go</a>`), true)
+		assert.Equal(t, strings.Contains(body, `<a href="/tag/web-dev" class="tag">#web-dev</a>`), true)
+
+		_, _, body = ts.get(t, "/")
+		assert.Equal(t, strings.Contains(body, `href="/tag/web-dev"`), true)
+	})
+
+	validationTests := []struct {
+		name     string
+		tags     string
+		wantBody string
+	}{
+		{"Too many", "a b c d e f", "at most 5 tags"},
+		{"Too long", strings.Repeat("x", 31), "more than 30 chars"},
+		{"Invalid chars", "c++", "can only contain letters"},
+		{"Dangling hyphen", "web-", "can only contain letters"},
+	}
+
+	for _, tt := range validationTests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, body := create(t, "Invalid tags", tt.tags)
+			assert.Equal(t, code, http.StatusUnprocessableEntity)
+			assert.Equal(t, strings.Contains(body, tt.wantBody), true)
+		})
+	}
+
+	_, err := app.memos.Insert(1, "Private memo", "Content", time.Time{},
+		models.MemoOptions{Visibility: models.VisibilityPrivate, Tags: []string{"go", "golang"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		urlPath     string
+		wantCode    int
+		wantBody    string
+		notWantBody string
+	}{
+		{"Tag page", "/tag/go", http.StatusOK, "Tagged memo", "Private memo"},
+		{"Mixed-case tag", "/tag/Go", http.StatusOK, "Tagged memo", "Private memo"},
+		{"Unused tag", "/tag/rust", http.StatusOK, "No memos are tagged #rust", "Tagged memo"},
+		{"Invalid tag", "/tag/C++", http.StatusNotFound, "", ""},
+		{"Browse by tag", "/memos?tag=%23Web-Dev", http.StatusOK, "Tagged memo", ""},
+		{"Suggestions", "/tags?q=g", http.StatusOK, `["go","golang"]`, ""},
+		{"Suggestions with hash", "/tags?q=%23we", http.StatusOK, `["web-dev"]`, ""},
+		{"No suggestions", "/tags?q=rust", http.StatusOK, "[]", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, body := ts.get(t, tt.urlPath)
+
+			assert.Equal(t, code, tt.wantCode)
+			assert.Equal(t, strings.Contains(body, tt.wantBody), true)
+			if tt.notWantBody != "" {
+				assert.Equal(t, strings.Contains(body, tt.notWantBody), false)
+			}
+		})
+	}
+
+	t.Run("Anonymous suggestions", func(t *testing.T) {
+		anon := newTestServer(t, app.routes())
+		_, header, body := anon.get(t, "/tags?q=go")
+		assert.Equal(t, header.Get("Content-Type"), "application/json")
+		assert.Equal(t, body, `["go"]`)
+	})
+}
+
+func TestHighlighting(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	ts.login(t, app, "alice")
+
+	create := func(t *testing.T, content, language string) (int, string) {
+		_, _, body := ts.get(t, "/memo/create")
+		form := url.Values{
+			"csrf_token": {extractCSRFToken(t, body)},
+			"title":      {"Code"},
+			"content":    {content},
+			"expires":    {"1d"},
+			"visibility": {models.VisibilityPublic},
+			"language":   {language},
+		}
+
+		code, header, _ := ts.postForm(t, "/memo/create", form)
+		return code, header.Get("Location")
+	}
+
+	t.Run("Chosen language", func(t *testing.T) {
+		code, location := create(t, "SELECT 1;\nSELECT 2;", "sql")
+		assert.Equal(t, code, http.StatusSeeOther)
+
+		_, _, body := ts.get(t, location)
+		assert.Equal(t, strings.Contains(body, `<span class="k">SELECT</span>`), true)
+		assert.Equal(t, strings.Contains(body, `id="L2"`), true)
+		assert.Equal(t, strings.Contains(body, "SQL &middot;"), true)
+	})
+
+	t.Run("Detected language", func(t *testing.T) {
+		code, location := create(t, "#!/bin/sh\necho hello", "")
+		assert.Equal(t, code, http.StatusSeeOther)
+
+		_, _, body := ts.get(t, location)
+		assert.Equal(t, strings.Contains(body, "Bash &middot;"), true)
+	})
+
+	t.Run("Invalid language", func(t *testing.T) {
+		code, _ := create(t, "Some content", "klingon")
+		assert.Equal(t, code, http.StatusUnprocessableEntity)
+	})
+
+	t.Run("Themes", func(t *testing.T) {
+		code, header, body := ts.get(t, "/highlight/monokai.css")
+		assert.Equal(t, code, http.StatusOK)
+		assert.Equal(t, header.Get("Content-Type"), "text/css; charset=utf-8")
+		assert.Equal(t, strings.Contains(body, ".chroma"), true)
+
+		code, _, _ = ts.get(t, "/highlight/klingon.css")
+		assert.Equal(t, code, http.StatusNotFound)
+
+		_, _, body = ts.get(t, "/")
+		assert.Equal(t, strings.Contains(body, `href="/highlight/github.css"`), true)
+
+		tests := []struct {
+			name         string
+			theme        string
+			next         string
+			wantCode     int
+			wantLocation string
+		}{
+			{"Valid", "monokai", "/about", http.StatusSeeOther, "/about"},
+			{"Other host", "monokai", "//example.com", http.StatusSeeOther, "/"},
+			{"Unknown theme", "klingon", "/", http.StatusBadRequest, ""},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				_, _, body := ts.get(t, "/")
+				form := url.Values{
+					"csrf_token": {extractCSRFToken(t, body)},
+					"theme":      {tt.theme},
+					"next":       {tt.next},
+				}
+
+				code, header, _ := ts.postForm(t, "/theme", form)
+				assert.Equal(t, code, tt.wantCode)
+				assert.Equal(t, header.Get("Location"), tt.wantLocation)
+			})
+		}
+
+		_, _, body = ts.get(t, "/")
+		assert.Equal(t, strings.Contains(body, `href="/highlight/monokai.css"`), true)
+	})
+}
+
+func TestMarkdown(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+
+	source := "# Shopping\n\n- [x] bread\n- [ ] milk\n\n<script>alert(1)</script>"
+
+	t.Run("Preview requires login", func(t *testing.T) {
+		code, _, _ := ts.postForm(t, "/memo/preview", url.Values{"content": {source}, "format": {"markdown"}})
+		assert.Equal(t, code, http.StatusBadRequest) // no CSRF token, to begin with
+	})
+
+	ts.login(t, app, "alice")
+
+	_, _, body := ts.get(t, "/memo/create")
+	csrfToken := extractCSRFToken(t, body)
+
+	tests := []struct {
+		name        string
+		format      string
+		language    string
+		wantCode    int
+		wantBody    string
+		notWantBody string
+	}{
+		{"Markdown", models.FormatMarkdown, "", http.StatusOK, "<h1>Shopping</h1>", "<script>"},
+		{"Plain text", models.FormatPlain, "markdown", http.StatusOK, `<span class="gh"># Shopping`, "<h1>"},
+		{"Invalid format", "html", "", http.StatusUnprocessableEntity, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{
+				"csrf_token": {csrfToken},
+				"content":    {source},
+				"format":     {tt.format},
+				"language":   {tt.language},
+			}
+
+			code, _, body := ts.postForm(t, "/memo/preview", form)
+			assert.Equal(t, code, tt.wantCode)
+			assert.Equal(t, strings.Contains(body, tt.wantBody), true)
+			if tt.notWantBody != "" {
+				assert.Equal(t, strings.Contains(body, tt.notWantBody), false)
+			}
+		})
+	}
+
+	t.Run("View", func(t *testing.T) {
+		form := url.Values{
+			"csrf_token": {csrfToken},
+			"title":      {"Shopping list"},
+			"content":    {source},
+			"expires":    {"1d"},
+			"visibility": {models.VisibilityPublic},
+			"format":     {models.FormatMarkdown},
+		}
+
+		code, header, _ := ts.postForm(t, "/memo/create", form)
+		assert.Equal(t, code, http.StatusSeeOther)
+
+		_, _, body := ts.get(t, header.Get("Location"))
+		assert.Equal(t, strings.Contains(body, "<h1>Shopping</h1>"), true)
+		assert.Equal(t, strings.Contains(body, `<input checked="" disabled="" type="checkbox"`), true)
+		assert.Equal(t, strings.Contains(body, "<script>alert"), false)
+	})
+}
+
+func TestMemoRaw(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+
+	err := app.users.Insert("alice", "alice@example.com", "pa55word")
+	if err != nil {
+		t.Fatal(err)
+	}
+	public, err := app.memos.Insert(1, "Hello, world: v2!", "print('<hello>')\n", time.Time{},
+		models.MemoOptions{Language: "python"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	notes, err := app.memos.Insert(1, "  ", "# Notes", time.Time{}, models.MemoOptions{Format: models.FormatMarkdown})
+	if err != nil {
+		t.Fatal(err)
+	}
+	private, err := app.memos.Insert(1, "Private", "Secret", time.Time{},
+		models.MemoOptions{Visibility: models.VisibilityPrivate})
+	if err != nil {
+		t.Fatal(err)
+	}
+	locked, err := app.memos.Insert(1, "Locked", "Secret", time.Time{}, models.MemoOptions{Password: "open sesame"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	burn, err := app.memos.Insert(1, "Burn", "Secret", time.Time{}, models.MemoOptions{BurnAfterReading: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("Raw", func(t *testing.T) {
+		code, header, body := ts.get(t, "/memo/raw/"+public)
+		assert.Equal(t, code, http.StatusOK)
+		assert.Equal(t, header.Get("Content-Type"), "text/plain; charset=utf-8")
+		assert.Equal(t, header.Get("Content-Disposition"), "")
+		assert.Equal(t, header.Get("ETag") != "", true)
+		assert.Equal(t, header.Get("Last-Modified") != "", true)
+		// Not escaped, unlike on the page.
+		assert.Equal(t, body, "print('<hello>')")
+	})
+
+	t.Run("Download", func(t *testing.T) {
+		tests := []struct {
+			name            string
+			slug            string
+			wantDisposition string
+		}{
+			{"Title & language", public, `attachment; filename=Hello-world-v2.py`},
+			{"Markdown without title", notes, fmt.Sprintf(`attachment; filename=%s.md`, notes)},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				code, header, _ := ts.get(t, "/memo/download/"+tt.slug)
+				assert.Equal(t, code, http.StatusOK)
+				assert.Equal(t, header.Get("Content-Type"), "text/plain; charset=utf-8")
+				assert.Equal(t, header.Get("Content-Disposition"), tt.wantDisposition)
+			})
+		}
+	})
+
+	t.Run("Conditional requests", func(t *testing.T) {
+		_, header, _ := ts.get(t, "/memo/raw/"+public)
+
+		tests := []struct {
+			name     string
+			header   string
+			value    string
+			wantCode int
+		}{
+			{"Same ETag", "If-None-Match", header.Get("ETag"), http.StatusNotModified},
+			{"Other ETag", "If-None-Match", `"other"`, http.StatusOK},
+			{"Not modified since", "If-Modified-Since", header.Get("Last-Modified"), http.StatusNotModified},
+			{"Modified since", "If-Modified-Since", "Mon, 02 Jan 2006 15:04:05 GMT", http.StatusOK},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				req, err := http.NewRequest(http.MethodGet, ts.URL+"/memo/raw/"+public, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				req.Header.Set(tt.header, tt.value)
+
+				rs, err := ts.Client().Do(req)
+				if err != nil {
+					t.Fatal(err)
+				}
+				code, _, _ := readResponse(t, rs)
+				assert.Equal(t, code, tt.wantCode)
+			})
+		}
+	})
+
+	// The same checks as viewing the memo.
+	t.Run("Access", func(t *testing.T) {
+		tests := []struct {
+			name         string
+			urlPath      string
+			wantCode     int
+			wantLocation string
+		}{
+			{"Private memo", "/memo/raw/" + private, http.StatusNotFound, ""},
+			{"Private download", "/memo/download/" + private, http.StatusNotFound, ""},
+			{"Password", "/memo/raw/" + locked, http.StatusSeeOther, "/memo/view/" + locked},
+			{"Burn after reading", "/memo/download/" + burn, http.StatusSeeOther, "/memo/view/" + burn},
+			{"Non-existent slug", "/memo/raw/doesnotexist", http.StatusNotFound, ""},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				code, header, _ := ts.get(t, tt.urlPath)
+				assert.Equal(t, code, tt.wantCode)
+				assert.Equal(t, header.Get("Location"), tt.wantLocation)
+			})
+		}
+	})
+}
+
+func TestMemoUpload(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	ts.login(t, app, "alice")
+
+	token := ts.newToken(t, "Laptop", models.ScopeWrite)
+
+	// Uploads don't need the session (nor a CSRF token), so they're sent without cookies.
+	client := *ts.Client()
+	client.Jar = nil
+
+	upload := func(t *testing.T, token, urlPath string, header http.Header, body io.Reader) (int, http.Header, string) {
+		req, err := http.NewRequest(http.MethodPost, ts.URL+urlPath, body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		rs, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return readResponse(t, rs)
+	}
+
+	// A multipart form with a `memo` field; `filename` makes it a file.
+	multipartForm := func(t *testing.T, filename, content string, fields map[string]string) (http.Header, io.Reader) {
+		var buf bytes.Buffer
+		mw := multipart.NewWriter(&buf)
+		for name, value := range fields {
+			mw.WriteField(name, value)
+		}
+		var w io.Writer
+		var err error
+		if filename != "" {
+			w, err = mw.CreateFormFile("memo", filename)
+		} else {
+			w, err = mw.CreateFormField("memo")
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(w, content)
+		mw.Close()
+
+		return http.Header{"Content-Type": {mw.FormDataContentType()}}, &buf
+	}
+
+	t.Run("Created", func(t *testing.T) {
+		header, multipartBody := multipartForm(t, "", "SELECT 1;", map[string]string{"title": "Query", "language": "sql"})
+		fileHeader, fileBody := multipartForm(t, "main.go", "package main\n\nfunc main() {}", nil)
+
+		tests := []struct {
+			name         string
+			urlPath      string
+			header       http.Header
+			body         io.Reader
+			wantTitle    string
+			wantLanguage string
+			wantContent  string
+		}{
+			{
+				name:         "Raw body",
+				urlPath:      "/",
+				header:       http.Header{"Content-Type": {"application/x-www-form-urlencoded"}},
+				body:         strings.NewReader("a=1&b=<2>"),
+				wantTitle:    "Untitled",
+				wantLanguage: "Plain text",
+				wantContent:  "a=1&amp;b=&lt;2&gt;",
+			},
+			{
+				name:         "Query options",
+				urlPath:      "/?title=Notes&expires=1h&language=markdown",
+				body:         strings.NewReader("# Notes"),
+				wantTitle:    "Notes",
+				wantLanguage: "Markdown",
+				wantContent:  "Notes",
+			},
+			{
+				name:         "Header options",
+				urlPath:      "/",
+				header:       http.Header{"X-Title": {"Script"}, "X-Expires": {"never"}},
+				body:         strings.NewReader("#!/bin/sh\necho hello"),
+				wantTitle:    "Script",
+				wantLanguage: "Bash",
+				wantContent:  "hello",
+			},
+			{
+				name:         "Multipart field",
+				urlPath:      "/",
+				header:       header,
+				body:         multipartBody,
+				wantTitle:    "Query",
+				wantLanguage: "SQL",
+				wantContent:  "SELECT",
+			},
+			{
+				name:         "Multipart file",
+				urlPath:      "/",
+				header:       fileHeader,
+				body:         fileBody,
+				wantTitle:    "main.go",
+				wantLanguage: "Go",
+				wantContent:  "package",
+			},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				code, header, body := upload(t, token, tt.urlPath, tt.header, tt.body)
+				assert.Equal(t, code, http.StatusCreated)
+				assert.Equal(t, header.Get("Content-Type"), "text/plain; charset=utf-8")
+				assert.Equal(t, body, header.Get("Location"))
+				assert.Equal(t, strings.HasPrefix(body, ts.URL+"/memo/view/"), true)
+
+				// The memo belongs to the owner of the token.
+				_, _, page := ts.get(t, strings.TrimPrefix(body, ts.URL))
+				assert.Equal(t, strings.Contains(page, "<strong>"+tt.wantTitle+"</strong>"), true)
+				assert.Equal(t, strings.Contains(page, tt.wantLanguage+" &middot;"), true)
+				assert.Equal(t, strings.Contains(page, tt.wantContent), true)
+				assert.Equal(t, strings.Contains(page, `href="/memo/edit/`), true)
+			})
+		}
+	})
+
+	t.Run("Rejected", func(t *testing.T) {
+		tests := []struct {
+			name     string
+			token    string
+			urlPath  string
+			body     string
+			wantCode int
+			wantBody string
+		}{
+			{"No token", "", "/", "Hello", http.StatusUnauthorized, "Unauthorized"},
+			{"Invalid token", token + "x", "/", "Hello", http.StatusUnauthorized, "Unauthorized"},
+			{"Empty", token, "/", "", http.StatusUnprocessableEntity, "content: This field cannot be blank."},
+			{"Invalid expiry", token, "/?expires=custom", "Hello", http.StatusUnprocessableEntity, "expires: Please choose one of the listed options"},
+			{"Invalid language", token, "/?language=klingon", "Hello", http.StatusUnprocessableEntity, "language: Please choose one of the listed options"},
+			{"Too large", token, "/", strings.Repeat("x", maxUploadSize+1), http.StatusRequestEntityTooLarge, ""},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				code, _, body := upload(t, tt.token, tt.urlPath, nil, strings.NewReader(tt.body))
+				assert.Equal(t, code, tt.wantCode)
+				assert.Equal(t, strings.Contains(body, tt.wantBody), true)
+			})
+		}
+	})
+
+	t.Run("Read-only token", func(t *testing.T) {
+		code, header, _ := upload(t, ts.newToken(t, "CI", models.ScopeRead), "/", nil, strings.NewReader("Hello"))
+		assert.Equal(t, code, http.StatusForbidden)
+		assert.Equal(t, strings.Contains(header.Get("WWW-Authenticate"), `error="insufficient_scope"`), true)
+	})
+}
+
+var tokenRX = regexp.MustCompile(`memobin_[\w-]+`)
+
+// Create a personal access token on the token page, as the logged in user.
+func (ts *testServer) newToken(t *testing.T, name, scope string) string {
+	_, _, body := ts.get(t, "/user/tokens")
+	code, _, body := ts.postForm(t, "/user/tokens", url.Values{
+		"csrf_token": {extractCSRFToken(t, body)},
+		"name":       {name},
+		"scope":      {scope},
+	})
+	if code != http.StatusOK {
+		t.Fatalf("creating a token failed with status %d", code)
+	}
+
+	token := tokenRX.FindString(body)
+	if token == "" {
+		t.Fatal("no token found in body")
+	}
+	return token
+}
+
+func TestTokens(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+
+	t.Run("Anonymous", func(t *testing.T) {
+		code, header, _ := ts.get(t, "/user/tokens")
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, header.Get("Location"), "/user/login")
+	})
+
+	ts.login(t, app, "alice")
+
+	_, _, body := ts.get(t, "/user/tokens")
+	assert.Equal(t, strings.Contains(body, "You don't have any tokens yet."), true)
+	csrfToken := extractCSRFToken(t, body)
+
+	t.Run("Invalid", func(t *testing.T) {
+		tests := []struct {
+			name      string
+			tokenName string
+			scope     string
+			wantError string
+		}{
+			{"Blank name", "  ", models.ScopeRead, "This field cannot be blank"},
+			{"Long name", strings.Repeat("x", models.MaxTokenNameLength+1), models.ScopeRead, "This field cannot be more than 100 chars long"},
+			{"Invalid scope", "Laptop", "admin", "Please choose one of the listed options"},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				code, _, body := ts.postForm(t, "/user/tokens", url.Values{
+					"csrf_token": {csrfToken},
+					"name":       {tt.tokenName},
+					"scope":      {tt.scope},
+				})
+				assert.Equal(t, code, http.StatusUnprocessableEntity)
+				assert.Equal(t, strings.Contains(body, tt.wantError), true)
+				assert.Equal(t, tokenRX.MatchString(body), false)
+			})
+		}
+	})
+
+	token := ts.newToken(t, "Laptop <work>", models.ScopeRead)
+
+	t.Run("Listed", func(t *testing.T) {
+		_, _, body := ts.get(t, "/user/tokens")
+		// The token itself is only shown once.
+		assert.Equal(t, tokenRX.MatchString(body), false)
+		assert.Equal(t, strings.Contains(body, "<td>Laptop &lt;work&gt;</td>"), true)
+		assert.Equal(t, strings.Contains(body, "<td>read</td>"), true)
+		assert.Equal(t, strings.Contains(body, "<td>Never</td>"), true)
+
+		// Using the token records when it was last used.
+		var res apiUserEnvelope
+		code, _ := ts.api(t, http.MethodGet, "/api/v1/user", token, "", &res)
+		assert.Equal(t, code, http.StatusOK)
+		_, _, body = ts.get(t, "/user/tokens")
+		assert.Equal(t, strings.Contains(body, "<td>Never</td>"), false)
+	})
+
+	tokens, err := app.users.Tokens(1)
+	if err != nil || len(tokens) != 1 {
+		t.Fatal("expected one token", err)
+	}
+	revoke := fmt.Sprintf("/user/tokens/%d/revoke", tokens[0].ID)
+
+	t.Run("Revoke someone else's", func(t *testing.T) {
+		other := newTestServer(t, app.routes())
+		other.login(t, app, "bob")
+		_, _, body := other.get(t, "/user/tokens")
+
+		code, _, _ := other.postForm(t, revoke, url.Values{"csrf_token": {extractCSRFToken(t, body)}})
+		assert.Equal(t, code, http.StatusNotFound)
+	})
+
+	t.Run("Revoke", func(t *testing.T) {
+		code, header, _ := ts.postForm(t, revoke, url.Values{"csrf_token": {csrfToken}})
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, header.Get("Location"), "/user/tokens")
+
+		_, _, body := ts.get(t, "/user/tokens")
+		assert.Equal(t, strings.Contains(body, "Token revoked."), true)
+		assert.Equal(t, strings.Contains(body, "Laptop &lt;work&gt;"), false)
+
+		var res apiErrorEnvelope
+		code, _ = ts.api(t, http.MethodGet, "/api/v1/user", token, "", &res)
+		assert.Equal(t, code, http.StatusUnauthorized)
+	})
+}
+
+func TestBurnAfterReading(t *testing.T) {
+	app := newTestApplication(t)
+	// Anonymous readers.
+	ts := newTestServer(t, app.routes())
+
+	owner := newTestServer(t, app.routes())
+	owner.login(t, app, "alice")
+	burn, err := app.memos.Insert(1, "Launch codes", "Top secret", time.Time{}, models.MemoOptions{BurnAfterReading: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("Owner", func(t *testing.T) {
+		code, _, body := owner.get(t, "/memo/view/"+burn)
+		assert.Equal(t, code, http.StatusOK)
+		assert.Equal(t, strings.Contains(body, "Top secret"), true)
+
+		_, err := app.memos.GetBySlug(burn)
+		assert.Equal(t, err, nil)
+	})
+
+	// The content can't be fetched without confirming either.
+	t.Run("Raw & download", func(t *testing.T) {
+		for _, urlPath := range []string{"/memo/raw/" + burn, "/memo/download/" + burn} {
+			code, header, body := ts.get(t, urlPath)
+			assert.Equal(t, code, http.StatusSeeOther)
+			assert.Equal(t, header.Get("Location"), "/memo/view/"+burn)
+			assert.Equal(t, strings.Contains(body, "Top secret"), false)
+		}
+	})
+
+	var csrfToken string
+
+	t.Run("Interstitial", func(t *testing.T) {
+		code, _, body := ts.get(t, "/memo/view/"+burn)
+		assert.Equal(t, code, http.StatusOK)
+		assert.Equal(t, strings.Contains(body, "This memo can only be read <strong>once</strong>"), true)
+		assert.Equal(t, strings.Contains(body, "Launch codes"), false)
+		assert.Equal(t, strings.Contains(body, "Top secret"), false)
+		csrfToken = extractCSRFToken(t, body)
+
+		// Looking at the page doesn't burn the memo.
+		_, err := app.memos.GetBySlug(burn)
+		assert.Equal(t, err, nil)
+	})
+
+	t.Run("Burn", func(t *testing.T) {
+		code, header, body := ts.postForm(t, "/memo/view/"+burn+"/burn", url.Values{"csrf_token": {csrfToken}})
+		assert.Equal(t, code, http.StatusOK)
+		assert.Equal(t, header.Get("Cache-Control"), "no-store")
+		assert.Equal(t, strings.Contains(body, "Top secret"), true)
+
+		// Only once.
+		code, _, body = ts.postForm(t, "/memo/view/"+burn+"/burn", url.Values{"csrf_token": {csrfToken}})
+		assert.Equal(t, code, http.StatusNotFound)
+		assert.Equal(t, strings.Contains(body, "Top secret"), false)
+
+		code, _, _ = ts.get(t, "/memo/view/"+burn)
+		assert.Equal(t, code, http.StatusNotFound)
+	})
+}
+
+func TestMemoUnlock(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	_, token := newAPIUser(t, app, "alice")
+
+	locked, err := app.memos.Insert(1, "Locked", "Top secret", time.Time{}, models.MemoOptions{Password: "open sesame"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Failed attempts are counted per memo, so the rate limit gets a memo of its own.
+	guessed, err := app.memos.Insert(1, "Guessed", "Top secret", time.Time{}, models.MemoOptions{Password: "open sesame"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, body := ts.get(t, "/memo/view/"+locked)
+	csrfToken := extractCSRFToken(t, body)
+	unlock := func(ts *testServer, slug, password string) (int, http.Header, string) {
+		return ts.postForm(t, "/memo/view/"+slug+"/unlock", url.Values{"csrf_token": {csrfToken}, "password": {password}})
+	}
+
+	t.Run("Locked", func(t *testing.T) {
+		code, _, body := ts.get(t, "/memo/view/"+locked)
+		assert.Equal(t, code, http.StatusOK)
+		assert.Equal(t, strings.Contains(body, "This memo is password-protected"), true)
+		assert.Equal(t, strings.Contains(body, "Top secret"), false)
+
+		for _, urlPath := range []string{"/memo/raw/" + locked, "/memo/download/" + locked} {
+			code, header, _ := ts.get(t, urlPath)
+			assert.Equal(t, code, http.StatusSeeOther)
+			assert.Equal(t, header.Get("Location"), "/memo/view/"+locked)
+		}
+
+		// The API only serves it to its owner, whether or not the session unlocked it.
+		var res apiErrorEnvelope
+		code, _ = ts.api(t, http.MethodGet, "/api/v1/memos/"+locked, "", "", &res)
+		assert.Equal(t, code, http.StatusForbidden)
+		assert.Equal(t, res.Error.Message, "The memo is password-protected")
+	})
+
+	t.Run("Wrong password", func(t *testing.T) {
+		code, _, body := unlock(ts, locked, "abracadabra")
+		assert.Equal(t, code, http.StatusUnprocessableEntity)
+		assert.Equal(t, strings.Contains(body, "Wrong password"), true)
+		assert.Equal(t, strings.Contains(body, "Top secret"), false)
+	})
+
+	t.Run("Too many attempts", func(t *testing.T) {
+		for range 5 {
+			code, _, _ := unlock(ts, guessed, "abracadabra")
+			assert.Equal(t, code, http.StatusUnprocessableEntity)
+		}
+
+		// Even the right password is refused for a while.
+		code, _, body := unlock(ts, guessed, "open sesame")
+		assert.Equal(t, code, http.StatusTooManyRequests)
+		assert.Equal(t, strings.Contains(body, "Too many failed attempts"), true)
+	})
+
+	t.Run("Right password", func(t *testing.T) {
+		code, header, _ := unlock(ts, locked, "open sesame")
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, header.Get("Location"), "/memo/view/"+locked)
+
+		code, _, body := ts.get(t, "/memo/view/"+locked)
+		assert.Equal(t, code, http.StatusOK)
+		assert.Equal(t, strings.Contains(body, "Top secret"), true)
+
+		code, _, body = ts.get(t, "/memo/raw/"+locked)
+		assert.Equal(t, code, http.StatusOK)
+		assert.Equal(t, body, "Top secret")
+
+		var res apiErrorEnvelope
+		code, _ = ts.api(t, http.MethodGet, "/api/v1/memos/"+locked, "", "", &res)
+		assert.Equal(t, code, http.StatusForbidden)
+	})
+
+	// The memo is unlocked for that session only.
+	t.Run("Other session", func(t *testing.T) {
+		other := newTestServer(t, app.routes())
+		code, _, body := other.get(t, "/memo/view/"+locked)
+		assert.Equal(t, code, http.StatusOK)
+		assert.Equal(t, strings.Contains(body, "This memo is password-protected"), true)
+		assert.Equal(t, strings.Contains(body, "Top secret"), false)
+
+		code, _, _ = other.get(t, "/memo/raw/"+locked)
+		assert.Equal(t, code, http.StatusSeeOther)
+	})
+
+	// Its owner doesn't need the password.
+	t.Run("Owner", func(t *testing.T) {
+		var res apiMemoEnvelope
+		code, _ := ts.api(t, http.MethodGet, "/api/v1/memos/"+locked, token, "", &res)
+		assert.Equal(t, code, http.StatusOK)
+		assert.Equal(t, res.Memo.Content, "Top secret")
+	})
+}
+
+func TestMemoEdit(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	ts.login(t, app, "alice")
+
+	slug, err := app.memos.Insert(1, "Shopping", "- milk", time.Time{}, models.MemoOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, body := ts.get(t, "/memo/edit/"+slug)
+	csrfToken := extractCSRFToken(t, body)
+	edit := func(title, content, version string) url.Values {
+		return url.Values{
+			"csrf_token": {csrfToken},
+			"title":      {title},
+			"content":    {content},
+			"expires":    {expiresKeep},
+			"visibility": {models.VisibilityPublic},
+			"version":    {version},
+		}
+	}
+
+	t.Run("Someone else's memo", func(t *testing.T) {
+		other := newTestServer(t, app.routes())
+		other.login(t, app, "bob")
+		_, _, body := other.get(t, "/memo/create")
+		form := edit("Mine", "- eggs", "1")
+		form.Set("csrf_token", extractCSRFToken(t, body))
+
+		code, _, _ := other.get(t, "/memo/edit/"+slug)
+		assert.Equal(t, code, http.StatusForbidden)
+		code, _, _ = other.postForm(t, "/memo/edit/"+slug, form)
+		assert.Equal(t, code, http.StatusForbidden)
+	})
+
+	t.Run("Saved", func(t *testing.T) {
+		code, header, _ := ts.postForm(t, "/memo/edit/"+slug, edit("Groceries", "- milk\n- eggs", "1"))
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, header.Get("Location"), "/memo/view/"+slug)
+
+		memo, err := app.memos.GetBySlug(slug)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, memo.Title, "Groceries")
+		assert.Equal(t, memo.Content, "- milk\n- eggs")
+		assert.Equal(t, memo.Version, 2)
+	})
+
+	// Based on the version before the one just saved, e.g. from another tab.
+	t.Run("Conflict", func(t *testing.T) {
+		code, _, body := ts.postForm(t, "/memo/edit/"+slug, edit("Food", "- bread", "1"))
+		assert.Equal(t, code, http.StatusConflict)
+		assert.Equal(t, strings.Contains(body, "This memo was changed after you started editing it"), true)
+		// Both the current version & the changes which weren't saved.
+		assert.Equal(t, strings.Contains(body, "Groceries"), true)
+		assert.Equal(t, strings.Contains(body, "- bread"), true)
+
+		memo, err := app.memos.GetBySlug(slug)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, memo.Title, "Groceries")
+		assert.Equal(t, memo.Version, 2)
+	})
+}
+
+// Memos from before slugs have a legacy ID, which only the SQL stores know about.
+func TestLegacyMemoURLs(t *testing.T) {
+	store, err := openStorage("sqlite", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.close()
+	_, err = store.migrator.Up(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := newTestApplication(t)
+	app.memos, app.users = store.memos, store.users
+	ts := newTestServer(t, app.routes())
+	owner := newTestServer(t, app.routes())
+	owner.login(t, app, "alice")
+	other := newTestServer(t, app.routes())
+	other.login(t, app, "bob")
+
+	public, err := app.memos.Insert(1, "Public", "Hello", time.Time{}, models.MemoOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	private, err := app.memos.Insert(1, "Private", "Secret", time.Time{}, models.MemoOptions{Visibility: models.VisibilityPrivate})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := store.memos.(*models.MemoModel).DB
+	for id, slug := range map[int]string{7: public, 8: private} {
+		_, err = db.Exec(`UPDATE memos SET legacy_id = ? WHERE slug = ?;`, id, slug)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name         string
+		ts           *testServer
+		urlPath      string
+		wantCode     int
+		wantLocation string
+	}{
+		{"Legacy ID", ts, "/memo/view/7", http.StatusMovedPermanently, "/memo/view/" + public},
+		{"Sub-page & query", ts, "/memo/view/7/diff?from=1", http.StatusMovedPermanently, "/memo/view/" + public + "/diff?from=1"},
+		{"Raw", ts, "/memo/raw/7", http.StatusMovedPermanently, "/memo/raw/" + public},
+		{"Private memo", ts, "/memo/view/8", http.StatusNotFound, ""},
+		{"Someone else's private memo", other, "/memo/view/8", http.StatusNotFound, ""},
+		{"Own private memo", owner, "/memo/view/8", http.StatusMovedPermanently, "/memo/view/" + private},
+		{"Unknown legacy ID", ts, "/memo/view/9", http.StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, header, _ := tt.ts.get(t, tt.urlPath)
+			assert.Equal(t, code, tt.wantCode)
+			assert.Equal(t, header.Get("Location"), tt.wantLocation)
+		})
+	}
+}
+
+func TestMemoHistory(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	ts.login(t, app, "alice")
+	other := newTestServer(t, app.routes())
+	other.login(t, app, "bob")
+
+	slug, err := app.memos.Insert(1, "Shopping", "- milk", time.Time{}, models.MemoOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	memo, err := app.memos.GetBySlug(slug)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = app.memos.Update(memo.ID, 1, "Groceries", "- eggs", time.Time{}, 1, models.MemoOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	private, err := app.memos.Insert(1, "Private", "Secret", time.Time{}, models.MemoOptions{Visibility: models.VisibilityPrivate})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("Pages", func(t *testing.T) {
+		tests := []struct {
+			name     string
+			ts       *testServer
+			urlPath  string
+			wantCode int
+			wantBody string
+		}{
+			{"History", other, "/memo/view/" + slug + "/history", http.StatusOK, "Shopping"},
+			{"Revision", other, "/memo/view/" + slug + "/history/1", http.StatusOK, "- milk"},
+			{"Non-existent revision", other, "/memo/view/" + slug + "/history/3", http.StatusNotFound, ""},
+			{"Diff", other, "/memo/view/" + slug + "/diff?from=1&to=2", http.StatusOK, "- eggs"},
+			{"Private history", other, "/memo/view/" + private + "/history", http.StatusNotFound, ""},
+			{"Private revision", other, "/memo/view/" + private + "/history/1", http.StatusNotFound, ""},
+			{"Private diff", other, "/memo/view/" + private + "/diff", http.StatusNotFound, ""},
+			{"Own private history", ts, "/memo/view/" + private + "/history", http.StatusOK, "Private"},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				code, _, body := tt.ts.get(t, tt.urlPath)
+				assert.Equal(t, code, tt.wantCode)
+				assert.Equal(t, strings.Contains(body, tt.wantBody), true)
+			})
+		}
+	})
+
+	restore := "/memo/view/" + slug + "/history/1/restore"
+
+	t.Run("Restore someone else's", func(t *testing.T) {
+		_, _, body := other.get(t, "/memo/view/"+slug+"/history")
+		code, _, _ := other.postForm(t, restore, url.Values{"csrf_token": {extractCSRFToken(t, body)}, "version": {"2"}})
+		assert.Equal(t, code, http.StatusForbidden)
+
+		memo, err := app.memos.GetBySlug(slug)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, memo.Version, 2)
+	})
+
+	t.Run("Restore", func(t *testing.T) {
+		_, _, body := ts.get(t, "/memo/view/"+slug+"/history/1")
+		code, header, _ := ts.postForm(t, restore, url.Values{"csrf_token": {extractCSRFToken(t, body)}, "version": {"2"}})
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, header.Get("Location"), "/memo/view/"+slug)
+
+		// The old version becomes a new one; the history isn't rewritten.
+		memo, err := app.memos.GetBySlug(slug)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, memo.Version, 3)
+		assert.Equal(t, memo.Title, "Shopping")
+		assert.Equal(t, memo.Content, "- milk")
+
+		revisions, err := app.memos.Revisions(memo)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, len(revisions), 3)
+		_, _, body = ts.get(t, "/memo/view/"+slug+"/history/2")
+		assert.Equal(t, strings.Contains(body, "- eggs"), true)
+	})
+}
+
+func TestMemoTrash(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	ts.login(t, app, "alice")
+	other := newTestServer(t, app.routes())
+	other.login(t, app, "bob")
+
+	slug, err := app.memos.Insert(1, "Old notes", "Hello", time.Time{}, models.MemoOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	memo, err := app.memos.GetBySlug(slug)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restore := fmt.Sprintf("/memo/trash/%d/restore", memo.ID)
+	purge := fmt.Sprintf("/memo/trash/%d/purge", memo.ID)
+
+	_, _, body := ts.get(t, "/memo/trash")
+	csrfToken := extractCSRFToken(t, body)
+	_, _, body = other.get(t, "/memo/trash")
+	otherCSRFToken := extractCSRFToken(t, body)
+
+	t.Run("Delete someone else's", func(t *testing.T) {
+		code, _, _ := other.postForm(t, "/memo/delete/"+slug, url.Values{"csrf_token": {otherCSRFToken}})
+		assert.Equal(t, code, http.StatusForbidden)
+
+		code, _, _ = ts.get(t, "/memo/view/"+slug)
+		assert.Equal(t, code, http.StatusOK)
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		code, header, _ := ts.postForm(t, "/memo/delete/"+slug, url.Values{"csrf_token": {csrfToken}})
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, header.Get("Location"), "/memo/trash")
+
+		code, _, _ = ts.get(t, "/memo/view/"+slug)
+		assert.Equal(t, code, http.StatusNotFound)
+		_, _, body := ts.get(t, "/")
+		assert.Equal(t, strings.Contains(body, "Old notes"), false)
+
+		_, _, body = ts.get(t, "/memo/trash")
+		assert.Equal(t, strings.Contains(body, "Old notes"), true)
+		_, _, body = other.get(t, "/memo/trash")
+		assert.Equal(t, strings.Contains(body, "Old notes"), false)
+	})
+
+	// Trashed memos can't be looked up by anyone but their owner, so they don't exist for anybody else.
+	t.Run("Someone else's trash", func(t *testing.T) {
+		for _, urlPath := range []string{restore, purge} {
+			code, _, _ := other.postForm(t, urlPath, url.Values{"csrf_token": {otherCSRFToken}})
+			assert.Equal(t, code, http.StatusNotFound)
+		}
+
+		_, _, body := ts.get(t, "/memo/trash")
+		assert.Equal(t, strings.Contains(body, "Old notes"), true)
+	})
+
+	t.Run("Restore", func(t *testing.T) {
+		code, header, _ := ts.postForm(t, restore, url.Values{"csrf_token": {csrfToken}})
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, header.Get("Location"), "/memo/trash")
+
+		code, _, _ = ts.get(t, "/memo/view/"+slug)
+		assert.Equal(t, code, http.StatusOK)
+		_, _, body := ts.get(t, "/")
+		assert.Equal(t, strings.Contains(body, "Old notes"), true)
+	})
+
+	t.Run("Purge", func(t *testing.T) {
+		code, _, _ := ts.postForm(t, "/memo/delete/"+slug, url.Values{"csrf_token": {csrfToken}})
+		assert.Equal(t, code, http.StatusSeeOther)
+
+		code, header, _ := ts.postForm(t, purge, url.Values{"csrf_token": {csrfToken}})
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, header.Get("Location"), "/memo/trash")
+
+		_, _, body := ts.get(t, "/memo/trash")
+		assert.Equal(t, strings.Contains(body, "Old notes"), false)
+		trash, err := app.memos.Trash(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, len(trash), 0)
+
+		// Gone for good.
+		code, _, _ = ts.postForm(t, restore, url.Values{"csrf_token": {csrfToken}})
+		assert.Equal(t, code, http.StatusNotFound)
+	})
+}
@@ -5,8 +5,13 @@ import (
 	"fmt"
 	"net/http"
 	"runtime/debug"
+	"strings"
 	"time"
+	"unicode"
 
+	"github.com/heschmat/MemoBin/internal/highlight"
+	"github.com/heschmat/MemoBin/internal/models"
+	"github.com/heschmat/MemoBin/internal/validator"
 	"github.com/justinas/nosurf"
 )
 
@@ -69,6 +74,88 @@ func (app *application) newTemplateData(r *http.Request) templateData {
 		// Add the flash message to the template data, if one exists.
 		Flash:           app.sessionManager.PopString(r.Context(), "flash"),
 		IsAuthenticated: app.isAuthenticated(r),
+		AuthenticatedUserID: app.authenticatedUserID(r),
 		CSRFToken: nosurf.Token(r),
+		Theme:     app.theme(r),
 	}
 }
+
+// Return the theme for highlighted code chosen in this session, or the default one.
+func (app *application) theme(r *http.Request) string {
+	theme := app.sessionManager.GetString(r.Context(), "theme")
+	if !validator.PermittedValue(theme, highlight.Themes...) {
+		return highlight.DefaultTheme
+	}
+	return theme
+}
+
+// Build the links to the pages around `page`: the current URL with the `cursor` parameter replaced.
+func newPagination(r *http.Request, page models.MemoPage) paginationData {
+	link := func(cursor string) string {
+		query := r.URL.Query()
+		query.Del("cursor")
+		if cursor != "" {
+			query.Set("cursor", cursor)
+		}
+		if len(query) == 0 {
+			return r.URL.Path
+		}
+		return r.URL.Path + "?" + query.Encode()
+	}
+
+	var p paginationData
+	if page.Prev != "" {
+		p.First = link("")
+		p.Prev = link(page.Prev)
+	}
+	if page.Next != "" {
+		p.Next = link(page.Next)
+	}
+	return p
+}
+
+// Write the content of a memo as plain text.
+// Every edit creates a new version, which makes it a good ETag; `http.ServeContent` takes care of
+// conditional requests (If-None-Match & If-Modified-Since), ranges and HEAD requests.
+func (app *application) serveMemoContent(w http.ResponseWriter, r *http.Request, memo models.Memo) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("ETag", fmt.Sprintf(`"%s-%d"`, memo.Slug, memo.Version))
+	// Caches must check back every time: the memo could be deleted, expire or become private.
+	w.Header().Set("Cache-Control", "private, no-cache")
+
+	http.ServeContent(w, r, "", memo.Updated, strings.NewReader(memo.Content))
+}
+
+// The name of the file a memo is downloaded as: its title (without any characters which are unsafe
+// in filenames) and the extension of its language, e.g. "Shopping-list.md".
+func downloadFilename(memo models.Memo) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case unicode.IsLetter(r), unicode.IsDigit(r), r == '-', r == '_', r == '.':
+			return r
+		case unicode.IsSpace(r):
+			return '-'
+		}
+		return -1
+	}, memo.Title)
+	// Collapse runs of hyphens, and don't start with a dot (hidden files).
+	name = strings.Join(strings.FieldsFunc(name, func(r rune) bool { return r == '-' }), "-")
+	name = strings.TrimLeft(name, ".")
+	if name == "" {
+		name = memo.Slug
+	}
+
+	if memo.Format == models.FormatMarkdown {
+		return name + ".md"
+	}
+	return name + highlight.Extension(memo.Language)
+}
+
+// The URL of the site as requested, e.g. "https://memobin.example", for absolute links.
+func baseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
@@ -1,43 +1,58 @@
 package main
 
 import (
-	"database/sql"
+	"context"
+	"errors"
 	"flag"
+	"html/template"
 	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
-	"text/template"
+	"sync"
+	"syscall"
 	"time"
 
-	"github.com/alexedwards/scs/mysqlstore"
 	"github.com/alexedwards/scs/v2"
 	"github.com/go-playground/form/v4"            // automatic form parsing
 	"github.com/heschmat/MemoBin/internal/models" // {project-model-path}/internal/models
-
-	_ "github.com/go-sql-driver/mysql" // added manually
 )
 
 // Define an application struct to hold the application-wide dependencies.
 type application struct {
 	debug          bool
 	logger         *slog.Logger
-	memos          *models.MemoModel // `MemoModel` will be available to our handlers.
+	memos          models.MemoStore // The memo store will be available to our handlers.
 	templateCache  map[string]*template.Template
 	formDecoder    *form.Decoder  // holds a pointer to a `form.Decoder` instance
 	sessionManager *scs.SessionManager
-	users          *models.UserModel
+	users          models.UserStore
+	sessions       models.SessionStore // nil if the session store cleans up by itself
+	unlockLimiter  *attemptLimiter // limits guessing the passwords of protected memos
+	sweepBatchSize int // max. number of rows the sweeper deletes per statement
 }
 
 
 func main() {
 	// The value of the flag will be stored in the `addr` variable at runtime.
 	addr := flag.String("addr", ":4000", "HTTP network address")
-	// Define a new command-line flag for the MySQL DSN string.
-	dsn := flag.String("dsn", "web:changeme@/memobin?parseTime=true", "MySQL data source name")
+	// The storage backend: MySQL, PostgreSQL, an embedded SQLite file, or nothing but memory (handy for development).
+	// By default, it's picked from the scheme of the DSN (e.g. `postgres://...`).
+	dbDriver := flag.String("db", "", "Storage backend: mysql, postgres, sqlite or memory (default: from the DSN)")
+	// Define a new command-line flag for the DSN string; empty means the backend's default.
+	dsn := flag.String("dsn", "", "Data source name (default: web:changeme@/memobin?parseTime=true for mysql)")
 
 	debug := flag.Bool("debug", true, "Enable debug mode")
 
+	// Apply pending schema migrations on startup (SQLite databases are always migrated).
+	autoMigrate := flag.Bool("migrate", false, "Apply pending database migrations on startup")
+
+	// Expired memos & sessions are purged in the background; an interval of 0 disables the sweeper
+	// (e.g. when `web sweep` is run from cron instead).
+	sweepInterval := flag.Duration("sweep-interval", 10*time.Minute, "How often to purge expired memos and sessions (0 to disable)")
+	sweepBatchSize := flag.Int("sweep-batch", 500, "Max. number of rows deleted per batch when sweeping")
+
 	// If any errors are encountered during parsing, the application will be terminated.
 	flag.Parse()
 
@@ -73,15 +88,41 @@ func main() {
         },
     }))
 
-	// Pass openDB() the DSN from the cl-flag:
-	db, err := openDB(*dsn)
+	// A batch of 0 rows (or a negative one, which SQLite treats as "no limit") would make the sweeper loop forever.
+	if *sweepBatchSize < 1 {
+		logger.Error("invalid -sweep-batch: must be at least 1", "value", *sweepBatchSize)
+		os.Exit(1)
+	}
+
+	// Pass openStorage() the backend & DSN from the cl-flags:
+	store, err := openStorage(*dbDriver, *dsn)
 	if err != nil {
 		logger.Error(err.Error())
 		os.Exit(1)
 	}
 
 	// So that the connection pool is closed before the main() exits.
-	defer db.Close()
+	defer store.close()
+
+	// `web migrate up|down|status` manages the database schema and exits.
+	if flag.Arg(0) == "migrate" {
+		err = runMigrate(context.Background(), store.migrator, flag.Args()[1:], os.Stdout)
+		if err != nil {
+			logger.Error(err.Error())
+			os.Exit(1)
+		}
+		return
+	}
+
+	// The embedded SQLite database is always kept up to date; other databases are usually
+	// migrated as a separate deployment step, but can be migrated on startup too.
+	if store.migrator != nil && (*autoMigrate || store.driver == "sqlite") {
+		err = migrateUp(context.Background(), store.migrator, logger)
+		if err != nil {
+			logger.Error(err.Error())
+			os.Exit(1)
+		}
+	}
 
 	// Initialize a new template cache...
 	templateCache, err := newTemplateCache()
@@ -94,8 +135,8 @@ func main() {
 	// scs.New() returns a pointer to `SessionManager` struct
 	// This holds the configuration settings for sessions.
 	sessionManager := scs.New()
-	// Configure `sessionManager` to use our MySQL database as the session store.
-	sessionManager.Store = mysqlstore.New(db)
+	// Configure `sessionManager` to keep sessions in the storage backend.
+	sessionManager.Store = store.sessionStore
 	// Set a lifetime of 12 hours; sessions automatically expire 12H after being created.
 	sessionManager.Lifetime = 12 * time.Hour
 
@@ -103,13 +144,25 @@ func main() {
 	app := &application{
 		debug:          *debug,
 		logger:         logger,
-		// Initialize a `models.MemoModel` instance containing the connection pool.
-		memos:          &models.MemoModel{DB: db},
+		memos:          store.memos,
 		templateCache:  templateCache,
 		// Initialize a decoder instance & add it to the application dependencies:
 		formDecoder:    form.NewDecoder(),
 		sessionManager: sessionManager,
-		users:          &models.UserModel{DB: db},
+		users:          store.users,
+		sessions:       store.sessions,
+		// Allow 5 wrong passwords per memo every 15 minutes.
+		unlockLimiter:  newAttemptLimiter(5, 15*time.Minute),
+		sweepBatchSize: *sweepBatchSize,
+	}
+
+	// `web sweep` runs a single sweep and exits; handy for cron jobs.
+	if flag.Arg(0) == "sweep" {
+		err = app.logSweep(context.Background())
+		if err != nil {
+			os.Exit(1)
+		}
+		return
 	}
 
 	// Initialize a new `http.Server` struct.
@@ -121,31 +174,51 @@ func main() {
 		ErrorLog: slog.NewLogLogger(logger.Handler(), slog.LevelError),
 	}
 
+	// `ctx` is cancelled when the process receives SIGINT (Ctrl+C) or SIGTERM.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Start the sweeper in the background.
+	var wg sync.WaitGroup
+	if *sweepInterval > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			app.runSweeper(ctx, *sweepInterval)
+		}()
+	}
+
+	// Once a signal arrives, stop accepting new requests
+	// and give the in-flight ones a few seconds to complete.
+	shutdownErr := make(chan error, 1)
+	go func() {
+		<-ctx.Done()
+		logger.Info("Shutting down server")
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		shutdownErr <- srv.Shutdown(shutdownCtx)
+	}()
+
 	// The value returned from the flag.String() function is a pointer to the flag value.
 	logger.Info("Starting serve", "addr", *addr)
 
 	// Call the `.ListenAndServe()` method on the `http.Server` struct to start the server:
+	// N.B. After `Shutdown()` is called, it returns `http.ErrServerClosed` straight away.
 	err = srv.ListenAndServe()
-	logger.Error(err.Error())
-	os.Exit(1)
-}
-
-
-// openDB() wraps sql.Open()
-// and returns a sql.DB connection pool for a given DSN.
-func openDB(dsn string) (*sql.DB, error) {
-	db, err := sql.Open("mysql", dsn)
-	if err != nil {
-		return nil, err
+	if !errors.Is(err, http.ErrServerClosed) {
+		logger.Error(err.Error())
+		os.Exit(1)
 	}
 
-	// Verfiy everything is setup correctly.
-	// db.Ping() creates a connection and checks for any error.
-	err = db.Ping()
+	err = <-shutdownErr
 	if err != nil {
-		db.Close()
-		return nil, err
+		logger.Error(err.Error())
+		os.Exit(1)
 	}
 
-	return db, nil
+	// Wait for the sweeper to finish its current batch.
+	wg.Wait()
+	logger.Info("Stopped server")
 }
+
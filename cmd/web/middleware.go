@@ -1,15 +1,19 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"strings"
 
+	"github.com/heschmat/MemoBin/internal/models"
 	"github.com/justinas/nosurf"
 )
 
 func commonHeaders(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request)  {
-		w.Header().Set("Content-Sequrity-Policy",
+		w.Header().Set("Content-Security-Policy",
 			"default-src 'self'; style-src 'self' fonts.googleapis.com; font-src fonts.gstatic.com")
 		w.Header().Set("Referrer-Policy", "origin-when-cross-origin")
 		w.Header().Set("X-Content-Type-Options", "nosniff")
@@ -65,3 +69,146 @@ func noSurf(next http.Handler) http.Handler {
 
 	return csrfHandler
 }
+
+
+// Redirect anonymous users to the login page.
+// The originally requested URL is remembered in the session, so that `userLoginPost`
+// can send the user back there once they've logged in.
+func (app *application) requireAuthentication(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !app.isAuthenticated(r) {
+			// Only GET requests can be safely replayed via a redirect.
+			if r.Method == http.MethodGet {
+				app.sessionManager.Put(r.Context(), "redirectPathAfterLogin", r.URL.RequestURI())
+			}
+			http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+			return
+		}
+
+		// Pages that require authentication shouldn't be stored in the browser cache
+		// (or any other intermediary cache).
+		w.Header().Add("Cache-Control", "no-store")
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Check that the user ID stored in the session still belongs to an existing user,
+// and record the result in the request context.
+func (app *application) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+		if id == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		exists, err := app.users.Exists(id)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		if exists {
+			ctx := context.WithValue(r.Context(), isAuthenticatedContextKey, true)
+			r = r.WithContext(ctx)
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Return the token in the request's `Authorization: Bearer <token>` header.
+// The token is the zero value if there's no such header; `models.ErrInvalidCredentials` means it's invalid.
+func (app *application) requestToken(r *http.Request) (models.Token, error) {
+	header := r.Header.Get("Authorization")
+	if header == "" {
+		return models.Token{}, nil
+	}
+
+	scheme, token, _ := strings.Cut(header, " ")
+	if !strings.EqualFold(scheme, "Bearer") || strings.TrimSpace(token) == "" {
+		return models.Token{}, models.ErrInvalidCredentials
+	}
+	return app.users.AuthenticateToken(strings.TrimSpace(token))
+}
+
+// Record in the request context that the request is authenticated with the token (i.e., as its owner).
+// Tokens are deleted along with their user, so there's no need to check that the user exists.
+func withToken(r *http.Request, token models.Token) *http.Request {
+	ctx := context.WithValue(r.Context(), isAuthenticatedContextKey, true)
+	ctx = context.WithValue(ctx, tokenContextKey, token)
+	return r.WithContext(ctx)
+}
+
+// Authenticate command-line clients by the token in their `Authorization: Bearer <token>` header,
+// instead of a session. As browsers never send that header by themselves, there's no CSRF token to check.
+// Requests without a valid token get a 401 Unauthorized response.
+// Uploads are all this is used for, so the token needs the write scope.
+func (app *application) requireToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, err := app.requestToken(r)
+		if err != nil && !errors.Is(err, models.ErrInvalidCredentials) {
+			app.serverError(w, r, err)
+			return
+		}
+		if token.ID == 0 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="memobin"`)
+			app.clientError(w, http.StatusUnauthorized)
+			return
+		}
+		if !token.Allows(models.ScopeWrite) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="memobin", error="insufficient_scope", scope="write"`)
+			app.clientError(w, http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, withToken(r, token))
+	})
+}
+
+// Authenticate API requests by their token, if they have one; requests without one are anonymous.
+// The API doesn't use sessions at all, so there's no CSRF token to check.
+// Invalid tokens get a 401 Unauthorized response (in JSON, like every API response).
+func (app *application) authenticateAPI(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, err := app.requestToken(r)
+		if err != nil {
+			if errors.Is(err, models.ErrInvalidCredentials) {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="memobin", error="invalid_token"`)
+				app.apiError(w, http.StatusUnauthorized, "The token is invalid")
+			} else {
+				app.apiServerError(w, r, err)
+			}
+			return
+		}
+		if token.ID != 0 {
+			r = withToken(r, token)
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Like `requireAuthentication`, for the API: anonymous requests get a 401 Unauthorized response,
+// and requests whose token doesn't have the `scope` a 403 Forbidden one.
+// N.B. The `authenticateAPI` middleware must run first.
+func (app *application) requireAPIScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, ok := r.Context().Value(tokenContextKey).(models.Token)
+			if !ok {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="memobin"`)
+				app.apiError(w, http.StatusUnauthorized, "This requires a token")
+				return
+			}
+			if !token.Allows(scope) {
+				w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="memobin", error="insufficient_scope", scope=%q`, scope))
+				app.apiError(w, http.StatusForbidden, fmt.Sprintf("This requires a token with the %s scope", scope))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
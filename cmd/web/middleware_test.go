@@ -0,0 +1,45 @@
+package main
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/heschmat/MemoBin/internal/assert"
+)
+
+// Scripts & the URLs they fetch, in the pages.
+var (
+	scriptRX = regexp.MustCompile(`<script[^>]*>`)
+	fetchRX  = regexp.MustCompile(`data-(?:preview|suggest)="([^"]*)"`)
+)
+
+func TestCommonHeaders(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	ts.login(t, app, "alice")
+
+	code, header, body := ts.get(t, "/memo/create")
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, header.Get("Content-Security-Policy"),
+		"default-src 'self'; style-src 'self' fonts.googleapis.com; font-src fonts.gstatic.com")
+	assert.Equal(t, header.Get("Referrer-Policy"), "origin-when-cross-origin")
+	assert.Equal(t, header.Get("X-Content-Type-Options"), "nosniff")
+	assert.Equal(t, header.Get("X-Frame-Options"), "deny")
+
+	// The policy only allows scripts & requests from the same origin (`default-src 'self'`),
+	// so there mustn't be inline scripts, and the memo form's preview & tag suggestions must be fetched from here.
+	scripts := scriptRX.FindAllString(body, -1)
+	assert.Equal(t, len(scripts), 1)
+	assert.Equal(t, strings.Contains(scripts[0], "src='/static/js/main.js'"), true)
+
+	urls := fetchRX.FindAllStringSubmatch(body, -1)
+	assert.Equal(t, len(urls), 2)
+	for _, u := range urls {
+		assert.Equal(t, strings.HasPrefix(u[1], "/") && !strings.HasPrefix(u[1], "//"), true)
+	}
+
+	code, _, _ = ts.get(t, "/static/js/main.js")
+	assert.Equal(t, code, http.StatusOK)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/heschmat/MemoBin/internal/migrations"
+)
+
+const migrateUsage = "usage: web migrate up | down [N] | status"
+
+// Run the `migrate` subcommand:
+//   - `up` applies all pending migrations,
+//   - `down [N]` reverts the last N applied migrations (default 1),
+//   - `status` lists every migration and when it was applied.
+func runMigrate(ctx context.Context, migrator *migrations.Migrator, args []string, w io.Writer) error {
+	if migrator == nil {
+		return errors.New("the in-memory backend has no schema to migrate")
+	}
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		for _, m := range applied {
+			fmt.Fprintf(w, "applied %04d_%s\n", m.Version, m.Name)
+		}
+		if err == nil && len(applied) == 0 {
+			fmt.Fprintln(w, "no pending migrations")
+		}
+		return err
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				return errors.New(migrateUsage)
+			}
+			steps = n
+		}
+
+		reverted, err := migrator.Down(ctx, steps)
+		for _, m := range reverted {
+			fmt.Fprintf(w, "reverted %04d_%s\n", m.Version, m.Name)
+		}
+		if err == nil && len(reverted) == 0 {
+			fmt.Fprintln(w, "no applied migrations")
+		}
+		return err
+
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "VERSION\tNAME\tAPPLIED")
+		for _, s := range statuses {
+			applied := "pending"
+			if !s.Applied.IsZero() {
+				applied = s.Applied.UTC().Format("2006-01-02 15:04:05 UTC")
+			}
+			fmt.Fprintf(tw, "%04d\t%s\t%s\n", s.Version, s.Name, applied)
+		}
+		return tw.Flush()
+	}
+
+	return errors.New(migrateUsage)
+}
+
+// Apply all pending migrations when the application starts, and log them.
+func migrateUp(ctx context.Context, migrator *migrations.Migrator, logger *slog.Logger) error {
+	applied, err := migrator.Up(ctx)
+	for _, m := range applied {
+		logger.Info("applied migration", "version", m.Version, "name", m.Name)
+	}
+	return err
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/heschmat/MemoBin/internal/assert"
+)
+
+func TestRunMigrate(t *testing.T) {
+	store, err := openStorage("sqlite", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.close()
+
+	tests := []struct {
+		name    string
+		args    []string
+		want    string
+		wantErr bool
+	}{
+		{"Up", []string{"up"}, "applied 0001_create_users\n", false},
+		{"Up again", []string{"up"}, "no pending migrations\n", false},
+		{"Down", []string{"down"}, "reverted 0010_add_token_details\n", false},
+		{"Status", []string{"status"}, "0010     add_token_details      pending\n", false},
+		{"Down 2", []string{"down", "2"}, "reverted 0009_create_tokens\nreverted 0008_add_memo_format\n", false},
+		{"Invalid step count", []string{"down", "none"}, "", true},
+		{"Unknown command", []string{"sideways"}, "", true},
+		{"No command", nil, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := runMigrate(context.Background(), store.migrator, tt.args, &buf)
+
+			assert.Equal(t, err != nil, tt.wantErr)
+			assert.Equal(t, strings.Contains(buf.String(), tt.want), true)
+		})
+	}
+}
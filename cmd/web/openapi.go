@@ -0,0 +1,384 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/heschmat/MemoBin/internal/highlight"
+	"github.com/heschmat/MemoBin/internal/models"
+)
+
+// The OpenAPI 3.1 document describing the JSON API, served at /api/openapi.json.
+// The schemas are generated from the Go types the handlers encode & decode (by reflection, following their
+// `json` tags), so they can't drift apart; the operations are listed in `apiOperations`, and the contract test
+// checks every response of the API tests against them.
+
+// An operation of the API, as documented.
+type apiOperation struct {
+	Method  string
+	Path    string // relative to /api/v1, with `{wildcards}` like the routes
+	Summary string
+	// The scope of the token the operation needs; empty if anonymous requests are allowed.
+	Scope string
+	// A form struct whose `form` tags are the query parameters, e.g. `memoBrowseForm{}`.
+	Query any
+	// The JSON body of the request, if any.
+	Request any
+	// The status codes of the responses & their JSON bodies; nil for responses without a body.
+	// Every operation can also respond with an `apiErrorEnvelope` for an invalid token (401) or an unexpected error (500).
+	Responses map[int]any
+}
+
+var apiOperations = []apiOperation{
+	{
+		Method: http.MethodGet, Path: "/memos", Summary: "List the public memos, a page at a time",
+		Query: memoBrowseForm{},
+		Responses: map[int]any{
+			http.StatusOK:                  apiMemoListEnvelope{},
+			http.StatusBadRequest:          apiErrorEnvelope{},
+			http.StatusUnprocessableEntity: apiErrorEnvelope{},
+		},
+	},
+	{
+		Method: http.MethodPost, Path: "/memos", Summary: "Create a memo",
+		Scope:   models.ScopeWrite,
+		Request: apiMemoInput{},
+		Responses: map[int]any{
+			http.StatusCreated:             apiMemoEnvelope{},
+			http.StatusBadRequest:          apiErrorEnvelope{},
+			http.StatusUnprocessableEntity: apiErrorEnvelope{},
+		},
+	},
+	{
+		Method: http.MethodGet, Path: "/memos/{slug}", Summary: "Get a memo, with its content",
+		Responses: map[int]any{
+			http.StatusOK:        apiMemoEnvelope{},
+			http.StatusForbidden: apiErrorEnvelope{}, // password-protected & burn-after-reading memos
+			http.StatusNotFound:  apiErrorEnvelope{},
+		},
+	},
+	{
+		Method: http.MethodPut, Path: "/memos/{slug}", Summary: "Update one of your memos",
+		Scope:   models.ScopeWrite,
+		Request: apiMemoInput{},
+		Responses: map[int]any{
+			http.StatusOK:                  apiMemoEnvelope{},
+			http.StatusBadRequest:          apiErrorEnvelope{},
+			http.StatusForbidden:           apiErrorEnvelope{},
+			http.StatusNotFound:            apiErrorEnvelope{},
+			http.StatusConflict:            apiErrorEnvelope{},
+			http.StatusUnprocessableEntity: apiErrorEnvelope{},
+		},
+	},
+	{
+		Method: http.MethodDelete, Path: "/memos/{slug}", Summary: "Move one of your memos to the trash",
+		Scope: models.ScopeWrite,
+		Responses: map[int]any{
+			http.StatusNoContent: nil,
+			http.StatusForbidden: apiErrorEnvelope{},
+			http.StatusNotFound:  apiErrorEnvelope{},
+		},
+	},
+	{
+		Method: http.MethodGet, Path: "/user", Summary: "Get the user the token belongs to",
+		Scope: models.ScopeRead,
+		Responses: map[int]any{
+			http.StatusOK: apiUserEnvelope{},
+		},
+	},
+}
+
+// What can't be told from the type of a field: keyed by the name of the Go type & the JSON (or form) name of the field.
+type apiFieldDoc struct {
+	Description string
+	Enum        []string
+	Format      string // e.g. "date"
+	Required    bool   // for request bodies, whose fields are otherwise optional
+}
+
+var apiFieldDocs = map[string]apiFieldDoc{
+	"apiMemo.url":        {Description: "The memo's page"},
+	"apiMemo.content":    {Description: "Only included when a single memo is requested"},
+	"apiMemo.expires":    {Description: "Null if the memo never expires"},
+	"apiMemo.visibility": {Enum: models.Visibilities},
+	"apiMemo.language":   {Enum: highlight.LanguageIDs()},
+	"apiMemo.format":     {Enum: models.Formats},
+
+	"apiMemoInput.title":   {Required: true},
+	"apiMemoInput.content": {Required: true},
+	"apiMemoInput.expires": {
+		Description: `Defaults to "7d"; when updating, "keep" (the default) keeps the expiry date`,
+		Enum:        orEmpty(append(slices.Clone(uploadExpiryOptions), expiresKeep)),
+	},
+	"apiMemoInput.password":           {Description: "Only when creating; it can't be changed later"},
+	"apiMemoInput.burn_after_reading": {Description: "Only when creating; it can't be changed later"},
+	"apiMemoInput.visibility":         {Description: "Defaults to public; when updating, to the current visibility", Enum: orEmpty(models.Visibilities)},
+	"apiMemoInput.tags":               {Description: "When updating, leaving them out keeps the current tags"},
+	"apiMemoInput.language": {
+		Description: "Detected from the content if it's left out; when updating, defaults to the current language",
+		Enum:        orEmpty(highlight.LanguageIDs()),
+	},
+	"apiMemoInput.format": {Description: "Defaults to plain; when updating, to the current format", Enum: orEmpty(models.Formats)},
+	"apiMemoInput.version": {
+		Description: "Only when updating: the version the changes are based on (409 if it's outdated); 0 overwrites whatever the current version is",
+	},
+
+	"apiMemoListEnvelope.prev": {Description: "The cursor of the previous page; left out on the first page"},
+	"apiMemoListEnvelope.next": {Description: "The cursor of the next page; left out on the last page"},
+
+	"apiErrorBody.message": {Description: "Meant for people"},
+	"apiErrorBody.fields":  {Description: "Validation errors by field name; only in 422 responses"},
+
+	"memoBrowseForm.author":   {Description: "The name of the author"},
+	"memoBrowseForm.from":     {Description: "Created on or after", Format: "date"},
+	"memoBrowseForm.to":       {Description: "Created on or before", Format: "date"},
+	"memoBrowseForm.expiring": {Description: "Only memos which expire"},
+	"memoBrowseForm.sort":     {Enum: models.SortOrders},
+	"memoBrowseForm.cursor":   {Description: "The `prev` or `next` cursor of another page"},
+}
+
+// The options of a field in request bodies, where an empty string means the default (like leaving the field out).
+func orEmpty(options []string) []string {
+	return append([]string{""}, options...)
+}
+
+// The wildcards of a path, e.g. "slug" in "/memos/{slug}".
+var pathWildcardRX = regexp.MustCompile(`\{(\w+)\}`)
+
+// Build the OpenAPI document of the API.
+// It's a tree of maps (rather than structs) as that's what JSON Schema is, in the end.
+func openAPIDocument() map[string]any {
+	schemas := make(map[string]any)
+	paths := make(map[string]any)
+	errorResponse := func(status int) map[string]any {
+		return apiResponse(schemas, status, apiErrorEnvelope{})
+	}
+
+	for _, op := range apiOperations {
+		responses := map[string]any{
+			"401": errorResponse(http.StatusUnauthorized),
+			"500": errorResponse(http.StatusInternalServerError),
+		}
+		if op.Scope == models.ScopeWrite {
+			responses["403"] = errorResponse(http.StatusForbidden)
+		}
+		for status, body := range op.Responses {
+			responses[strconv.Itoa(status)] = apiResponse(schemas, status, body)
+		}
+
+		operation := map[string]any{
+			"summary":   op.Summary,
+			"responses": responses,
+		}
+
+		// Anonymous requests are allowed unless the operation needs a scope (the empty requirement).
+		security := []any{map[string]any{"token": []string{}}}
+		if op.Scope == "" {
+			security = append(security, map[string]any{})
+		} else {
+			operation["description"] = fmt.Sprintf("Needs a token with the %s scope.", op.Scope)
+		}
+		operation["security"] = security
+
+		var parameters []any
+		for _, m := range pathWildcardRX.FindAllStringSubmatch(op.Path, -1) {
+			parameters = append(parameters, map[string]any{
+				"name": m[1], "in": "path", "required": true, "schema": map[string]any{"type": "string"},
+			})
+		}
+		if op.Query != nil {
+			parameters = append(parameters, queryParameters(reflect.TypeOf(op.Query))...)
+		}
+		if parameters != nil {
+			operation["parameters"] = parameters
+		}
+
+		if op.Request != nil {
+			operation["requestBody"] = map[string]any{
+				"required": true,
+				"content": map[string]any{
+					"application/json": map[string]any{"schema": schemaOf(schemas, reflect.TypeOf(op.Request), true)},
+				},
+			}
+		}
+
+		item, ok := paths[op.Path].(map[string]any)
+		if !ok {
+			item = make(map[string]any)
+			paths[op.Path] = item
+		}
+		item[strings.ToLower(op.Method)] = operation
+	}
+
+	return map[string]any{
+		"openapi": "3.1.0",
+		"info": map[string]any{
+			"title":   "MemoBin API",
+			"version": "1",
+		},
+		// Relative to the document, i.e. on the same host.
+		"servers": []any{map[string]any{"url": "/api/v1"}},
+		"paths":   paths,
+		"components": map[string]any{
+			"schemas": schemas,
+			"securitySchemes": map[string]any{
+				"token": map[string]any{
+					"type":        "http",
+					"scheme":      "bearer",
+					"description": "A personal access token, created on the Tokens page (/user/tokens)",
+				},
+			},
+		},
+	}
+}
+
+// A response of an operation; `body` is nil for responses without one.
+func apiResponse(schemas map[string]any, status int, body any) map[string]any {
+	response := map[string]any{"description": http.StatusText(status)}
+	if body != nil {
+		response["content"] = map[string]any{
+			"application/json": map[string]any{"schema": schemaOf(schemas, reflect.TypeOf(body), false)},
+		}
+	}
+	// Created resources are always located by the response.
+	if status == http.StatusCreated {
+		response["headers"] = map[string]any{
+			"Location": map[string]any{"required": true, "schema": map[string]any{"type": "string"}},
+		}
+	}
+	return response
+}
+
+// The query parameters described by the `form` tags of a form struct.
+func queryParameters(t reflect.Type) []any {
+	var parameters []any
+	for i := range t.NumField() {
+		f := t.Field(i)
+		name := f.Tag.Get("form")
+		if !f.IsExported() || name == "" || name == "-" {
+			continue
+		}
+
+		schema := schemaOf(nil, f.Type, true)
+		doc := apiFieldDocs[t.Name()+"."+name]
+		applyFieldDoc(schema, doc)
+
+		parameter := map[string]any{"name": name, "in": "query", "schema": schema}
+		if doc.Description != "" {
+			parameter["description"] = doc.Description
+			delete(schema, "description")
+		}
+		parameters = append(parameters, parameter)
+	}
+	return parameters
+}
+
+// The JSON Schema of a Go type, as encoded by `encoding/json`.
+// Structs become components in `schemas`, which are referred to by name (e.g. `apiMemo` is "Memo").
+// In requests (`input`) every field is optional unless its `apiFieldDoc` says otherwise, as the handlers
+// default them; in responses every field is present unless it's `omitempty`.
+// Types the API doesn't use (yet) panic, so they can't be documented wrongly.
+func schemaOf(schemas map[string]any, t reflect.Type, input bool) map[string]any {
+	if t == reflect.TypeFor[time.Time]() {
+		return map[string]any{"type": "string", "format": "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		// Nil pointers are null.
+		schema := schemaOf(schemas, t.Elem(), input)
+		if typ, ok := schema["type"].(string); ok {
+			schema["type"] = []string{typ, "null"}
+			return schema
+		}
+		return map[string]any{"anyOf": []any{schema, map[string]any{"type": "null"}}}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		return map[string]any{"type": "integer"}
+	case reflect.Slice:
+		return map[string]any{"type": "array", "items": schemaOf(schemas, t.Elem(), input)}
+	case reflect.Map:
+		if t.Key().Kind() == reflect.String {
+			return map[string]any{"type": "object", "additionalProperties": schemaOf(schemas, t.Elem(), input)}
+		}
+	case reflect.Struct:
+		return componentOf(schemas, t, input)
+	}
+
+	panic(fmt.Sprintf("openapi: the type %s isn't supported", t))
+}
+
+// Add the schema of a struct to `schemas` (unless it's there already) and return a reference to it.
+func componentOf(schemas map[string]any, t reflect.Type, input bool) map[string]any {
+	name := strings.TrimPrefix(t.Name(), "api")
+	if name == "" {
+		panic(fmt.Sprintf("openapi: the anonymous struct %s isn't supported", t))
+	}
+	name = strings.ToUpper(name[:1]) + name[1:]
+	ref := map[string]any{"$ref": "#/components/schemas/" + name}
+	if _, ok := schemas[name]; ok {
+		return ref
+	}
+	// Claim the name first, in case the struct refers to itself.
+	schemas[name] = nil
+
+	properties := make(map[string]any)
+	required := []string{}
+	for i := range t.NumField() {
+		f := t.Field(i)
+		field, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if !f.IsExported() || field == "-" {
+			continue
+		}
+		if f.Anonymous {
+			panic(fmt.Sprintf("openapi: the embedded field %s of %s isn't supported", f.Name, t))
+		}
+		if field == "" {
+			field = f.Name
+		}
+
+		schema := schemaOf(schemas, f.Type, input)
+		doc := apiFieldDocs[t.Name()+"."+field]
+		applyFieldDoc(schema, doc)
+		properties[field] = schema
+
+		if input && doc.Required || !input && !slices.Contains(strings.Split(opts, ","), "omitempty") {
+			required = append(required, field)
+		}
+	}
+
+	schemas[name] = map[string]any{
+		"type":       "object",
+		"properties": properties,
+		"required":   required,
+		// Requests with unknown fields are rejected (see `readJSON`).
+		"additionalProperties": false,
+	}
+	return ref
+}
+
+func applyFieldDoc(schema map[string]any, doc apiFieldDoc) {
+	if doc.Description != "" {
+		schema["description"] = doc.Description
+	}
+	if doc.Enum != nil {
+		schema["enum"] = doc.Enum
+	}
+	if doc.Format != "" {
+		schema["format"] = doc.Format
+	}
+}
+
+// GET /api/openapi.json
+func (app *application) apiDocument(w http.ResponseWriter, r *http.Request) {
+	app.writeJSON(w, http.StatusOK, openAPIDocument())
+}
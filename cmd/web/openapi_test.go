@@ -0,0 +1,376 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/heschmat/MemoBin/internal/assert"
+)
+
+// The OpenAPI document, decoded the way clients see it: JSON objects, arrays, strings, float64s & bools.
+var apiSpec = sync.OnceValue(func() map[string]any {
+	js, err := json.Marshal(openAPIDocument())
+	if err != nil {
+		panic(err)
+	}
+	var spec map[string]any
+	err = json.Unmarshal(js, &spec)
+	if err != nil {
+		panic(err)
+	}
+	return spec
+})
+
+// Check an exchange with the API against the OpenAPI document: the status code has to be documented
+// for the operation, and the body has to match its schema. Successful requests also have to match the schema
+// of the request body, so the document doesn't reject what the API accepts.
+// Requests outside /api/v1 aren't checked; requests to undocumented URLs have to be 404 errors.
+func checkContract(method, target, requestBody string, code int, header http.Header, body string) error {
+	u, err := url.Parse(target)
+	if err != nil {
+		return err
+	}
+	urlPath, ok := strings.CutPrefix(u.Path, "/api/v1")
+	if !ok {
+		return nil
+	}
+
+	spec := apiSpec()
+	errorSchema := map[string]any{"$ref": "#/components/schemas/ErrorEnvelope"}
+
+	operation, ok := findOperation(spec, method, urlPath)
+	if !ok {
+		if code != http.StatusNotFound {
+			return fmt.Errorf("%s %s isn't documented, but responded with %d rather than 404", method, urlPath, code)
+		}
+		return checkJSON(spec, errorSchema, header, body)
+	}
+
+	response, ok := dig(operation, "responses", strconv.Itoa(code)).(map[string]any)
+	if !ok {
+		return fmt.Errorf("%s %s responded with %d, which isn't documented", method, urlPath, code)
+	}
+
+	headers, _ := dig(response, "headers").(map[string]any)
+	for name := range headers {
+		if header.Get(name) == "" {
+			return fmt.Errorf("%s %s responded with %d but without the %s header", method, urlPath, code, name)
+		}
+	}
+
+	if schema, ok := dig(response, "content", "application/json", "schema").(map[string]any); ok {
+		err = checkJSON(spec, schema, header, body)
+	} else if body != "" {
+		err = fmt.Errorf("responded with the body %q, but none is documented", body)
+	}
+	if err != nil {
+		return fmt.Errorf("%s %s (%d): %w", method, urlPath, code, err)
+	}
+
+	if schema, ok := dig(operation, "requestBody", "content", "application/json", "schema").(map[string]any); ok && code < 300 {
+		var value any
+		err = json.Unmarshal([]byte(requestBody), &value)
+		if err == nil {
+			err = checkSchema(spec, schema, value, "body")
+		}
+		if err != nil {
+			return fmt.Errorf("%s %s succeeded, but the request doesn't match the document: %w", method, urlPath, err)
+		}
+	}
+
+	return nil
+}
+
+// Find the operation whose path matches `urlPath`, e.g. "/memos/{slug}" for "/memos/abc".
+func findOperation(spec map[string]any, method, urlPath string) (map[string]any, bool) {
+	segments := strings.Split(urlPath, "/")
+	for path, item := range spec["paths"].(map[string]any) {
+		pattern := strings.Split(path, "/")
+		if len(pattern) != len(segments) {
+			continue
+		}
+		match := true
+		for i, s := range pattern {
+			if s != segments[i] && !(strings.HasPrefix(s, "{") && segments[i] != "") {
+				match = false
+				break
+			}
+		}
+		if match {
+			operation, ok := item.(map[string]any)[strings.ToLower(method)].(map[string]any)
+			return operation, ok
+		}
+	}
+	return nil, false
+}
+
+// Look up a value nested in JSON objects; nil if there's no such value.
+func dig(v any, keys ...string) any {
+	for _, key := range keys {
+		object, ok := v.(map[string]any)
+		if !ok {
+			return nil
+		}
+		v = object[key]
+	}
+	return v
+}
+
+func checkJSON(spec, schema map[string]any, header http.Header, body string) error {
+	if ct := header.Get("Content-Type"); ct != "application/json" {
+		return fmt.Errorf("the Content-Type is %q rather than application/json", ct)
+	}
+	var value any
+	err := json.Unmarshal([]byte(body), &value)
+	if err != nil {
+		return fmt.Errorf("%w in %q", err, body)
+	}
+	return checkSchema(spec, schema, value, "body")
+}
+
+// Check a decoded JSON value against a schema, i.e. the parts of JSON Schema which `schemaOf()` generates.
+// `at` is where the value is, for the error messages (e.g. "body.memo.tags[0]").
+func checkSchema(spec, schema map[string]any, value any, at string) error {
+	if ref, ok := schema["$ref"].(string); ok {
+		name := strings.TrimPrefix(ref, "#/components/schemas/")
+		component, ok := dig(spec, "components", "schemas", name).(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s: the schema %s doesn't exist", at, ref)
+		}
+		return checkSchema(spec, component, value, at)
+	}
+
+	if anyOf, ok := schema["anyOf"].([]any); ok {
+		for _, s := range anyOf {
+			if checkSchema(spec, s.(map[string]any), value, at) == nil {
+				return nil
+			}
+		}
+		return fmt.Errorf("%s: %v doesn't match any of the schemas", at, value)
+	}
+
+	var types []string
+	switch t := schema["type"].(type) {
+	case string:
+		types = []string{t}
+	case []any:
+		for _, s := range t {
+			types = append(types, s.(string))
+		}
+	}
+	if !slices.Contains(types, jsonType(value)) && !(jsonType(value) == "integer" && slices.Contains(types, "number")) {
+		return fmt.Errorf("%s: %s isn't one of the types %v", at, jsonType(value), types)
+	}
+
+	if enum, ok := schema["enum"].([]any); ok && !slices.Contains(enum, value) {
+		return fmt.Errorf("%s: %v isn't one of %v", at, value, enum)
+	}
+
+	switch value := value.(type) {
+	case string:
+		if schema["format"] == "date-time" {
+			_, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return fmt.Errorf("%s: %w", at, err)
+			}
+		}
+	case []any:
+		items, _ := schema["items"].(map[string]any)
+		for i, item := range value {
+			err := checkSchema(spec, items, item, fmt.Sprintf("%s[%d]", at, i))
+			if err != nil {
+				return err
+			}
+		}
+	case map[string]any:
+		required, _ := schema["required"].([]any)
+		for _, name := range required {
+			if _, ok := value[name.(string)]; !ok {
+				return fmt.Errorf("%s: the required property %q is missing", at, name)
+			}
+		}
+		properties, _ := schema["properties"].(map[string]any)
+		for name, v := range value {
+			s, ok := properties[name].(map[string]any)
+			if !ok {
+				s, ok = schema["additionalProperties"].(map[string]any)
+			}
+			if !ok {
+				return fmt.Errorf("%s: the property %q isn't documented", at, name)
+			}
+			err := checkSchema(spec, s, v, at+"."+name)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// The JSON Schema type of a decoded JSON value.
+func jsonType(value any) string {
+	switch value := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if value == float64(int64(value)) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+func TestOpenAPI(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	_, token := newAPIUser(t, app, "alice")
+
+	t.Run("Document", func(t *testing.T) {
+		rs, err := ts.Client().Get(ts.URL + "/api/openapi.json")
+		if err != nil {
+			t.Fatal(err)
+		}
+		code, header, body := readResponse(t, rs)
+		assert.Equal(t, code, http.StatusOK)
+		assert.Equal(t, header.Get("Content-Type"), "application/json")
+
+		var served map[string]any
+		err = json.Unmarshal([]byte(body), &served)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, served["openapi"], any("3.1.0"))
+		assert.Equal(t, len(dig(served, "paths").(map[string]any)), 3)
+
+		// The validator's error shape: a message, and the messages of the invalid fields by name.
+		fields := dig(served, "components", "schemas", "ErrorBody", "properties", "fields")
+		assert.Equal(t, dig(fields, "type"), any("object"))
+		assert.Equal(t, dig(fields, "additionalProperties", "type"), any("string"))
+
+		// The request body has the fields of `apiMemoInput`, and nothing else.
+		input := dig(served, "components", "schemas", "MemoInput")
+		assert.Equal(t, len(dig(input, "properties").(map[string]any)), 10)
+		assert.Equal(t, dig(input, "additionalProperties"), any(false))
+	})
+
+	t.Run("Routes", func(t *testing.T) {
+		// Every documented operation is served by the API, rather than the catch-all for unknown URLs.
+		for _, op := range apiOperations {
+			urlPath := "/api/v1" + strings.ReplaceAll(op.Path, "{slug}", "doesnotexist")
+			var res apiErrorEnvelope
+			ts.api(t, op.Method, urlPath, token, "", &res)
+			if res.Error.Message == "There's no such endpoint" {
+				t.Errorf("%s %s is documented, but not routed", op.Method, op.Path)
+			}
+		}
+	})
+
+	t.Run("Checks", func(t *testing.T) {
+		jsonHeader := http.Header{"Content-Type": []string{"application/json"}}
+		memo := `{"slug": "abc", "url": "https://example.com/memo/view/abc", "title": "Memo", "content": "x", "author": "alice",
+			"created": "2025-01-01T00:00:00Z", "updated": "2025-01-01T00:00:00Z", "expires": null, "version": 1,
+			"visibility": "public", "burn_after_reading": false, "password_protected": false, "tags": [],
+			"language": "plaintext", "format": "plain"}`
+
+		tests := []struct {
+			name    string
+			method  string
+			target  string
+			request string
+			code    int
+			header  http.Header
+			body    string
+			wantErr string
+		}{
+			{
+				name: "Valid", method: http.MethodGet, target: "/api/v1/memos/abc",
+				code: http.StatusOK, header: jsonHeader, body: `{"memo": ` + memo + `}`,
+			},
+			{
+				name: "Undocumented status", method: http.MethodGet, target: "/api/v1/memos/abc",
+				code: http.StatusTeapot, header: jsonHeader, body: `{"error": {"message": "I'm a teapot"}}`,
+				wantErr: "responded with 418, which isn't documented",
+			},
+			{
+				name: "Missing property", method: http.MethodGet, target: "/api/v1/memos/abc",
+				code: http.StatusOK, header: jsonHeader, body: `{"memo": ` + strings.Replace(memo, `"slug": "abc",`, "", 1) + `}`,
+				wantErr: `body.memo: the required property "slug" is missing`,
+			},
+			{
+				name: "Undocumented property", method: http.MethodGet, target: "/api/v1/user",
+				code: http.StatusOK, header: jsonHeader,
+				body:    `{"user": {"id": 1, "name": "alice", "email": "a@example.com", "created": "2025-01-01T00:00:00Z", "admin": true}}`,
+				wantErr: `body.user: the property "admin" isn't documented`,
+			},
+			{
+				name: "Wrong type", method: http.MethodGet, target: "/api/v1/memos",
+				code: http.StatusUnprocessableEntity, header: jsonHeader,
+				body:    `{"error": {"message": "Some fields are invalid", "fields": {"sort": ["Please choose one of the listed options"]}}}`,
+				wantErr: "body.error.fields.sort: array isn't one of the types [string]",
+			},
+			{
+				name: "Not in the enum", method: http.MethodGet, target: "/api/v1/memos/abc",
+				code: http.StatusOK, header: jsonHeader, body: `{"memo": ` + strings.Replace(memo, `"public"`, `"secret"`, 1) + `}`,
+				wantErr: "body.memo.visibility: secret isn't one of",
+			},
+			{
+				name: "Missing header", method: http.MethodPost, target: "/api/v1/memos", request: `{"title": "Memo", "content": "x"}`,
+				code: http.StatusCreated, header: jsonHeader, body: `{"memo": ` + memo + `}`,
+				wantErr: "without the Location header",
+			},
+			{
+				name: "Defaults", method: http.MethodPost, target: "/api/v1/memos",
+				request: `{"title": "Memo", "content": "x", "expires": "", "visibility": "", "language": "", "format": ""}`,
+				code:    http.StatusCreated, header: http.Header{"Content-Type": []string{"application/json"}, "Location": []string{"/api/v1/memos/abc"}},
+				body: `{"memo": ` + memo + `}`,
+			},
+			{
+				name: "Undocumented request", method: http.MethodPost, target: "/api/v1/memos", request: `{"content": "x"}`,
+				code: http.StatusCreated, header: http.Header{"Content-Type": []string{"application/json"}, "Location": []string{"/api/v1/memos/abc"}},
+				body:    `{"memo": ` + memo + `}`,
+				wantErr: `the request doesn't match the document: body: the required property "title" is missing`,
+			},
+			{
+				name: "Not JSON", method: http.MethodGet, target: "/api/v1/memos/abc",
+				code: http.StatusNotFound, header: http.Header{"Content-Type": []string{"text/plain; charset=utf-8"}}, body: "404 page not found",
+				wantErr: `the Content-Type is "text/plain; charset=utf-8"`,
+			},
+			{
+				name: "Undocumented endpoint", method: http.MethodGet, target: "/api/v1/nothing",
+				code: http.StatusOK, header: jsonHeader, body: `{}`,
+				wantErr: "isn't documented, but responded with 200",
+			},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				err := checkContract(tt.method, tt.target, tt.request, tt.code, tt.header, tt.body)
+				if tt.wantErr == "" {
+					assert.Equal(t, err, nil)
+					return
+				}
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("got %v; want an error containing %q", err, tt.wantErr)
+				}
+			})
+		}
+	})
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// `attemptLimiter` counts failed attempts (e.g. wrong memo passwords) per key
+// and blocks a key once it reaches `max` failures within `window`.
+// The window starts with the first failure and the count is reset when it ends.
+// N.B. State is kept in memory, so it's per process and lost on restart.
+type attemptLimiter struct {
+	mu       sync.Mutex
+	max      int
+	window   time.Duration
+	failures map[int]*attempts
+}
+
+type attempts struct {
+	count int
+	reset time.Time
+}
+
+func newAttemptLimiter(max int, window time.Duration) *attemptLimiter {
+	return &attemptLimiter{
+		max:      max,
+		window:   window,
+		failures: make(map[int]*attempts),
+	}
+}
+
+// Report whether another attempt is allowed for `key`.
+func (l *attemptLimiter) Allow(key int) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	a, ok := l.failures[key]
+	if !ok {
+		return true
+	}
+
+	if time.Now().After(a.reset) {
+		delete(l.failures, key)
+		return true
+	}
+
+	return a.count < l.max
+}
+
+// Record a failed attempt for `key`.
+func (l *attemptLimiter) Fail(key int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+
+	a, ok := l.failures[key]
+	if !ok || now.After(a.reset) {
+		// Drop entries whose window has ended, so the map doesn't keep growing.
+		for k, a := range l.failures {
+			if now.After(a.reset) {
+				delete(l.failures, k)
+			}
+		}
+
+		a = &attempts{reset: now.Add(l.window)}
+		l.failures[key] = a
+	}
+
+	a.count++
+}
+
+// Forget the failed attempts for `key`, e.g. after a successful attempt.
+func (l *attemptLimiter) Reset(key int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.failures, key)
+}
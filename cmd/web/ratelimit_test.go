@@ -0,0 +1,35 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/heschmat/MemoBin/internal/assert"
+)
+
+func TestAttemptLimiter(t *testing.T) {
+	l := newAttemptLimiter(3, time.Hour)
+
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, l.Allow(1), true)
+		l.Fail(1)
+	}
+
+	// The 4th attempt for key 1 is blocked, other keys aren't affected.
+	assert.Equal(t, l.Allow(1), false)
+	assert.Equal(t, l.Allow(2), true)
+
+	l.Reset(1)
+	assert.Equal(t, l.Allow(1), true)
+}
+
+func TestAttemptLimiterWindow(t *testing.T) {
+	l := newAttemptLimiter(1, time.Millisecond)
+
+	l.Fail(1)
+	assert.Equal(t, l.Allow(1), false)
+
+	// Once the window has passed, attempts are allowed again.
+	time.Sleep(2 * time.Millisecond)
+	assert.Equal(t, l.Allow(1), true)
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"net/http"
 
+	"github.com/heschmat/MemoBin/internal/models"
 	"github.com/justinas/alice"
 )
 
@@ -13,10 +14,16 @@ func (app *application) routes() http.Handler {
 	fileServer := http.FileServer(http.Dir("./ui/static/"))
 	// Register the `fileServer` as the handler for all URL paths starting with '/static/'
 	mux.Handle("GET /static/", http.StripPrefix("/static", fileServer))
+	// The stylesheets of the themes for highlighted code are generated, rather than files.
+	mux.HandleFunc("GET /highlight/{file}", app.themeCSS)
 
 	// We leave the static files route unchanged.
 	// Create a new middleware chain containing the middleware specific to our dynamic application routes.
-	dynamic := alice.New(app.sessionManager.LoadAndSave, noSurf)
+	dynamic := alice.New(app.sessionManager.LoadAndSave, noSurf, app.authenticate)
+
+	// Routes which are only available to logged in users.
+	// Anonymous visitors are redirected to the login page.
+	protected := dynamic.Append(app.requireAuthentication)
 
 	// Update the routes to use the `dynamic` middleware chain,
 	// followed by the appropriate handler function.
@@ -24,16 +31,59 @@ func (app *application) routes() http.Handler {
 	// Registering the other application routes
 	mux.Handle("GET /{$}", dynamic.ThenFunc(app.home)) // Restrict the route to exact matches on / only
 	mux.Handle("GET /about", dynamic.ThenFunc(app.about))
-	mux.Handle("GET /memo/view/{id}", dynamic.ThenFunc(app.memoView))
-	mux.Handle("GET /memo/create", dynamic.ThenFunc(app.memoCreate))
-	mux.Handle("POST /memo/create", dynamic.ThenFunc(app.memoCreatePost))
+	mux.Handle("GET /memos", dynamic.ThenFunc(app.memoBrowse))
+	mux.Handle("GET /memo/search", dynamic.ThenFunc(app.memoSearch))
+	mux.Handle("GET /tag/{name}", dynamic.ThenFunc(app.tagView))
+	mux.Handle("GET /tags", dynamic.ThenFunc(app.tagSuggestions))
+	mux.Handle("POST /theme", dynamic.ThenFunc(app.themePost))
+	mux.Handle("GET /memo/view/{slug}", dynamic.ThenFunc(app.memoView))
+	mux.Handle("GET /memo/raw/{slug}", dynamic.ThenFunc(app.memoRaw))
+	mux.Handle("GET /memo/download/{slug}", dynamic.ThenFunc(app.memoDownload))
+	mux.Handle("POST /memo/view/{slug}/burn", dynamic.ThenFunc(app.memoBurnPost))
+	mux.Handle("POST /memo/view/{slug}/unlock", dynamic.ThenFunc(app.memoUnlockPost))
+	mux.Handle("GET /memo/view/{slug}/history", dynamic.ThenFunc(app.memoHistory))
+	mux.Handle("GET /memo/view/{slug}/history/{version}", dynamic.ThenFunc(app.memoRevision))
+	mux.Handle("POST /memo/view/{slug}/history/{version}/restore", protected.ThenFunc(app.memoRestoreRevisionPost))
+	mux.Handle("GET /memo/view/{slug}/diff", dynamic.ThenFunc(app.memoDiff))
+	mux.Handle("GET /memo/create", protected.ThenFunc(app.memoCreate))
+	mux.Handle("POST /memo/create", protected.ThenFunc(app.memoCreatePost))
+	mux.Handle("POST /memo/preview", protected.ThenFunc(app.memoPreviewPost))
+	mux.Handle("GET /memo/edit/{slug}", protected.ThenFunc(app.memoEdit))
+	mux.Handle("POST /memo/edit/{slug}", protected.ThenFunc(app.memoEditPost))
+	mux.Handle("POST /memo/delete/{slug}", protected.ThenFunc(app.memoDeletePost))
+	mux.Handle("GET /memo/trash", protected.ThenFunc(app.memoTrash))
+	mux.Handle("POST /memo/trash/{id}/restore", protected.ThenFunc(app.memoTrashRestorePost))
+	mux.Handle("POST /memo/trash/{id}/purge", protected.ThenFunc(app.memoTrashPurgePost))
 
 	// User auth routes ---------------------------------------------- //
 	mux.Handle("GET /user/signup", dynamic.ThenFunc(app.userSignup))
 	mux.Handle("POST /user/signup", dynamic.ThenFunc(app.userSignupPost))
 	mux.Handle("GET /user/login", dynamic.ThenFunc(app.userLogin))
 	mux.Handle("POST /user/login", dynamic.ThenFunc(app.userLoginPost))
-	mux.Handle("POST /user/logout", dynamic.ThenFunc(app.userLogoutPost))
+	mux.Handle("POST /user/logout", protected.ThenFunc(app.userLogoutPost))
+	mux.Handle("GET /user/tokens", protected.ThenFunc(app.userTokens))
+	mux.Handle("POST /user/tokens", protected.ThenFunc(app.userTokensPost))
+	mux.Handle("POST /user/tokens/{id}/revoke", protected.ThenFunc(app.userTokenRevokePost))
+
+	// Uploads from the command line authenticate with a token instead of a session,
+	// so they skip the session & CSRF middleware.
+	mux.Handle("POST /{$}", alice.New(app.requireToken).ThenFunc(app.memoUploadPost))
+
+	// The JSON API authenticates with tokens too, rather than sessions (so there are no CSRF tokens either).
+	api := alice.New(app.authenticateAPI)
+	// Any token can read; changing memos needs the write scope.
+	apiRead := api.Append(app.requireAPIScope(models.ScopeRead))
+	apiWrite := api.Append(app.requireAPIScope(models.ScopeWrite))
+	mux.Handle("GET /api/v1/memos", api.ThenFunc(app.apiMemoList))
+	mux.Handle("POST /api/v1/memos", apiWrite.ThenFunc(app.apiMemoCreate))
+	mux.Handle("GET /api/v1/memos/{slug}", api.ThenFunc(app.apiMemoGet))
+	mux.Handle("PUT /api/v1/memos/{slug}", apiWrite.ThenFunc(app.apiMemoUpdate))
+	mux.Handle("DELETE /api/v1/memos/{slug}", apiWrite.ThenFunc(app.apiMemoDelete))
+	mux.Handle("GET /api/v1/user", apiRead.ThenFunc(app.apiUser))
+	// The OpenAPI document describing the API; it's public, like the API's documentation.
+	mux.HandleFunc("GET /api/openapi.json", app.apiDocument)
+	// Errors are JSON throughout the API, even for URLs which don't exist.
+	mux.Handle("/api/", api.ThenFunc(app.apiNotFound))
 
 	// middlewares chain
 	// return app.recoverPanic(app.logRequest(commonHeaders(mux)))
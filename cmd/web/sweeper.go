@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// Counts of the rows removed by a single sweep.
+type sweepResult struct {
+	ExpiredMemos    int64
+	PurgedTrash     int64
+	ExpiredSessions int64
+}
+
+// Permanently delete expired memos, memos which have been in the trash for too long and expired sessions.
+// Rows are deleted in batches of `app.sweepBatchSize`, so that a large backlog doesn't lock the tables for long.
+func (app *application) sweep(ctx context.Context) (sweepResult, error) {
+	var res sweepResult
+	var err error
+
+	res.ExpiredMemos, err = sweepBatches(ctx, app.sweepBatchSize, app.memos.DeleteExpired)
+	if err != nil {
+		return res, err
+	}
+
+	res.PurgedTrash, err = sweepBatches(ctx, app.sweepBatchSize, app.memos.PurgeTrash)
+	if err != nil {
+		return res, err
+	}
+
+	// Not every session store needs help with cleaning up.
+	if app.sessions != nil {
+		res.ExpiredSessions, err = sweepBatches(ctx, app.sweepBatchSize, app.sessions.DeleteExpired)
+		if err != nil {
+			return res, err
+		}
+	}
+
+	return res, nil
+}
+
+// Call `deleteBatch` until it deletes fewer than `limit` rows (i.e. nothing is left),
+// or `ctx` is cancelled. Returns the total number of rows deleted.
+func sweepBatches(ctx context.Context, limit int, deleteBatch func(limit int) (int64, error)) (int64, error) {
+	var total int64
+
+	for {
+		n, err := deleteBatch(limit)
+		total += n
+		if err != nil {
+			return total, err
+		}
+
+		// An empty batch means there's nothing left, whatever the limit.
+		if n == 0 || n < int64(limit) {
+			return total, nil
+		}
+
+		// Stop between batches if the application is shutting down.
+		if err := ctx.Err(); err != nil {
+			return total, err
+		}
+	}
+}
+
+// Run `sweep()` every `interval` until `ctx` is cancelled.
+func (app *application) runSweeper(ctx context.Context, interval time.Duration) {
+	app.logger.Info("starting sweeper", "interval", interval.String())
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			app.logger.Info("stopped sweeper")
+			return
+		case <-ticker.C:
+			app.logSweep(ctx)
+		}
+	}
+}
+
+// Run a single sweep and report the result through the logger.
+func (app *application) logSweep(ctx context.Context) error {
+	start := time.Now()
+
+	res, err := app.sweep(ctx)
+	if err != nil {
+		app.logger.Error("sweep failed", "error", err.Error(),
+			"expired_memos", res.ExpiredMemos, "purged_trash", res.PurgedTrash, "expired_sessions", res.ExpiredSessions)
+		return err
+	}
+
+	app.logger.Info("sweep finished", "duration", time.Since(start).String(),
+		"expired_memos", res.ExpiredMemos, "purged_trash", res.PurgedTrash, "expired_sessions", res.ExpiredSessions)
+	return nil
+}
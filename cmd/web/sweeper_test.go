@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/heschmat/MemoBin/internal/assert"
+)
+
+func TestSweepBatches(t *testing.T) {
+	// Pretend there are 7 rows to delete.
+	remaining := int64(7)
+	calls := 0
+	deleteBatch := func(limit int) (int64, error) {
+		calls++
+		n := min(remaining, int64(limit))
+		remaining -= n
+		return n, nil
+	}
+
+	total, err := sweepBatches(context.Background(), 3, deleteBatch)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, total, int64(7))
+	assert.Equal(t, remaining, int64(0))
+	assert.Equal(t, calls, 3) // 3 + 3 + 1
+}
+
+func TestSweepBatchesCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// Every batch is full, so only cancellation can stop the loop.
+	deleteBatch := func(limit int) (int64, error) {
+		return int64(limit), nil
+	}
+
+	total, err := sweepBatches(ctx, 10, deleteBatch)
+
+	assert.Equal(t, err, context.Canceled)
+	assert.Equal(t, total, int64(10))
+}
+
+func TestSweepBatchesZeroLimit(t *testing.T) {
+	// A batch which deletes nothing must end the sweep, even if the limit is 0.
+	calls := 0
+	deleteBatch := func(limit int) (int64, error) {
+		calls++
+		return 0, nil
+	}
+
+	total, err := sweepBatches(context.Background(), 0, deleteBatch)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, total, int64(0))
+	assert.Equal(t, calls, 1)
+}
@@ -1,11 +1,15 @@
 package main
 
 import (
+	"html/template"
 	"path/filepath"
-	"text/template"
 	"time"
 
+	"github.com/heschmat/MemoBin/internal/diff"
+	"github.com/heschmat/MemoBin/internal/highlight"
+	"github.com/heschmat/MemoBin/internal/markdown"
 	"github.com/heschmat/MemoBin/internal/models"
+	"github.com/heschmat/MemoBin/internal/search"
 )
 
 // Define a `templateData`
@@ -15,10 +19,49 @@ type templateData struct {
 	CurrentYear int
 	Memo        models.Memo
 	Memos       []models.Memo
+	Revision    models.Revision
+	Revisions   []models.Revision
+	Diff        diffData
+	Search      searchData
+	Tag         string
+	Pagination  paginationData
 	Form        any
 	Flash       string
 	IsAuthenticated bool
+	AuthenticatedUserID int
 	CSRFToken    string
+	Theme        string // of highlighted code; one of `highlight.Themes`
+	Tokens       []models.Token
+	Token        string // a newly generated token, which is only shown once
+	BaseURL      string // e.g. "https://memobin.example", for examples of commands
+}
+
+// The difference between two versions of a memo.
+// `Mode` is either "unified" (rendered from `Hunks`) or "split" (side-by-side, rendered from `Rows`).
+type diffData struct {
+	From  models.Revision
+	To    models.Revision
+	Mode  string
+	Hunks []diff.Hunk
+	Rows  []diff.Row
+}
+
+// The results of a search; `Query` is also shown in the search box of every page.
+type searchData struct {
+	Query   string
+	Results []searchResult
+}
+
+// A memo found by a search, with the search terms highlighted in its title & in a snippet of its content.
+type searchResult struct {
+	Memo    models.Memo
+	Title   []search.Segment
+	Snippet []search.Segment
+}
+
+// Links to the neighbouring pages of a listing; empty where there's no such page.
+type paginationData struct {
+	First, Prev, Next string
 }
 
 // YYYY-MM-DD HH:MM:SS +0000 UTC => 16 Dec 2024 at 12:21
@@ -32,8 +75,29 @@ func humanDate(t time.Time) string {
 	return t.UTC().Format("02 Jan 2006 at 15:04")
 }
 
+// Render a memo's content as highlighted code.
+// N.B. `template.HTML` is written into the page as it is; that's safe, as chroma escapes the content.
+func highlightHTML(content, language string) (template.HTML, error) {
+	html, err := highlight.HTML(content, language)
+	return template.HTML(html), err
+}
+
+// Render a Markdown memo.
+// N.B. `template.HTML` is written into the page as it is; that's safe, as the output is sanitized.
+func markdownHTML(content string) (template.HTML, error) {
+	html, err := markdown.Render(content)
+	return template.HTML(html), err
+}
+
+// Everything else written into a page is escaped according to its context (HTML, attribute, URL, ...),
+// so helpers should return plain strings, unless they produce HTML which is known to be safe.
 var functions = template.FuncMap{
-	"humanDate": humanDate,
+	"humanDate":    humanDate,
+	"highlight":    highlightHTML,
+	"markdown":     markdownHTML,
+	"languageName": highlight.LanguageName,
+	"languages":    func() []highlight.Language { return highlight.Languages },
+	"themes":       func() []string { return highlight.Themes },
 }
 
 
@@ -1,10 +1,13 @@
 package main
 
 import (
+	"bytes"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/heschmat/MemoBin/internal/assert"
+	"github.com/heschmat/MemoBin/internal/models"
 )
 
 // func TestHumanDate(t *testing.T) {
@@ -53,3 +56,82 @@ func TestHumanDate(t *testing.T) {
 }
 
 // go test -v ./cmd/web
+
+// Render a page from the template cache with the given data.
+func renderPage(t *testing.T, page string, data templateData) string {
+	cache, err := newTemplateCache()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := new(bytes.Buffer)
+	err = cache[page].ExecuteTemplate(buf, "base", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+const script = `<script>alert("xss")</script>`
+
+func TestTemplatesEscapeMemos(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+	}{
+		{"Plain text", models.FormatPlain},
+		{"Markdown", models.FormatMarkdown},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			memo := models.Memo{
+				ID:      1,
+				Slug:    "abcdefghijkl",
+				Author:  script,
+				Title:   script,
+				Content: "Hello\n\n" + script,
+				Format:  tt.format,
+				Tags:    []string{"go"},
+				Version: 1,
+			}
+
+			for _, page := range []string{"view.tmpl.html", "home.tmpl.html"} {
+				body := renderPage(t, page, templateData{Memo: memo, Memos: []models.Memo{memo}, Theme: "github"})
+				assert.Equal(t, strings.Contains(body, "<script>"), false)
+			}
+
+			body := renderPage(t, "view.tmpl.html", templateData{Memo: memo, Theme: "github"})
+			assert.Equal(t, strings.Contains(body, "&lt;script&gt;alert(&#34;xss&#34;)&lt;/script&gt;"), true)
+		})
+	}
+}
+
+func TestTemplatesEscapeForms(t *testing.T) {
+	form := memoCreateForm{
+		Title:   `"><script>alert(1)</script>`,
+		Content: `</textarea>` + script,
+		Tags:    `" onfocus="alert(1)`,
+	}
+	form.AddFieldError("title", script)
+
+	body := renderPage(t, "create.tmpl.html", templateData{Form: form, Theme: "github"})
+	assert.Equal(t, strings.Contains(body, "<script>"), false)
+	assert.Equal(t, strings.Contains(body, `value="&#34;&gt;&lt;script&gt;alert(1)&lt;/script&gt;"`), true)
+	assert.Equal(t, strings.Contains(body, "&lt;/textarea&gt;"), true)
+	assert.Equal(t, strings.Contains(body, `" onfocus="`), false)
+}
+
+func TestTemplatesEscapeFlash(t *testing.T) {
+	body := renderPage(t, "about.tmpl.html", templateData{Flash: script, Theme: "github"})
+	assert.Equal(t, strings.Contains(body, "<script>alert"), false)
+	assert.Equal(t, strings.Contains(body, `<div class="flash">&lt;script&gt;`), true)
+}
+
+func TestTemplatesEscapeSearch(t *testing.T) {
+	data := templateData{Theme: "github"}
+	data.Search.Query = script
+	body := renderPage(t, "search.tmpl.html", data)
+	assert.Equal(t, strings.Contains(body, "<script>alert"), false)
+	assert.Equal(t, strings.Contains(body, `value="&lt;script&gt;`), true)
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"html"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/alexedwards/scs/v2"
+	"github.com/go-playground/form/v4"
+	"github.com/heschmat/MemoBin/internal/models"
+)
+
+func TestMain(m *testing.M) {
+	// Templates & static files are loaded relative to the project root.
+	err := os.Chdir("../..")
+	if err != nil {
+		panic(err)
+	}
+
+	os.Exit(m.Run())
+}
+
+// Create an application backed by the in-memory store, so handler tests don't need a database.
+func newTestApplication(t *testing.T) *application {
+	templateCache, err := newTemplateCache()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	memos, users := models.NewMemoryStores()
+
+	// The session manager keeps its sessions in memory by default.
+	sessionManager := scs.New()
+	sessionManager.Lifetime = 12 * time.Hour
+	sessionManager.Cookie.Secure = true
+
+	return &application{
+		logger:         slog.New(slog.NewTextHandler(io.Discard, nil)),
+		memos:          memos,
+		users:          users,
+		templateCache:  templateCache,
+		formDecoder:    form.NewDecoder(),
+		sessionManager: sessionManager,
+		unlockLimiter:  newAttemptLimiter(5, 15*time.Minute),
+		sweepBatchSize: 100,
+	}
+}
+
+// A test server whose client keeps cookies between requests and doesn't follow redirects.
+type testServer struct {
+	*httptest.Server
+}
+
+func newTestServer(t *testing.T, h http.Handler) *testServer {
+	// TLS, as the session & CSRF cookies are `Secure`.
+	ts := httptest.NewTLSServer(h)
+	t.Cleanup(ts.Close)
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts.Client().Jar = jar
+
+	ts.Client().CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	return &testServer{ts}
+}
+
+func (ts *testServer) get(t *testing.T, urlPath string) (int, http.Header, string) {
+	rs, err := ts.Client().Get(ts.URL + urlPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return readResponse(t, rs)
+}
+
+func (ts *testServer) postForm(t *testing.T, urlPath string, form url.Values) (int, http.Header, string) {
+	rs, err := ts.Client().PostForm(ts.URL+urlPath, form)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return readResponse(t, rs)
+}
+
+func readResponse(t *testing.T, rs *http.Response) (int, http.Header, string) {
+	defer rs.Body.Close()
+	body, err := io.ReadAll(rs.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return rs.StatusCode, rs.Header, string(bytes.TrimSpace(body))
+}
+
+var csrfTokenRX = regexp.MustCompile(`name="csrf_token" value="?([^">\s]+)`)
+
+// Extract the CSRF token from a page containing a form.
+func extractCSRFToken(t *testing.T, body string) string {
+	matches := csrfTokenRX.FindStringSubmatch(body)
+	if len(matches) < 2 {
+		t.Fatal("no csrf token found in body")
+	}
+
+	return html.UnescapeString(matches[1])
+}
+
+// Sign up a user and log the test client in as them.
+func (ts *testServer) login(t *testing.T, app *application, name string) {
+	email := name + "@example.com"
+	err := app.users.Insert(name, email, "pa55word")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, body := ts.get(t, "/user/login")
+	form := url.Values{
+		"csrf_token": {extractCSRFToken(t, body)},
+		"email":      {email},
+		"password":   {"pa55word"},
+	}
+
+	code, _, _ := ts.postForm(t, "/user/login", form)
+	if code != http.StatusSeeOther {
+		t.Fatalf("login failed with status %d", code)
+	}
+}
@@ -0,0 +1,234 @@
+// Package diff computes line-based differences between two texts,
+// e.g. two revisions of a memo.
+package diff
+
+import "strings"
+
+// Op describes what happened to a line.
+type Op int
+
+const (
+	Equal Op = iota
+	Delete
+	Insert
+)
+
+// Line is a single line of a diff.
+// `OldNum`/`NewNum` are the 1-based line numbers in the old/new text (0 if the line isn't part of it).
+type Line struct {
+	Op     Op
+	Text   string
+	OldNum int
+	NewNum int
+}
+
+// Helpers for templates, which can't compare against the `Op` constants directly.
+func (l Line) IsEqual() bool  { return l.Op == Equal }
+func (l Line) IsDelete() bool { return l.Op == Delete }
+func (l Line) IsInsert() bool { return l.Op == Insert }
+
+// Hunk is a group of changed lines surrounded by some unchanged context lines.
+type Hunk struct {
+	OldStart, OldLines int
+	NewStart, NewLines int
+	Lines              []Line
+}
+
+// Row is one row of a side-by-side diff.
+// Either side is nil where the line only exists in the other text.
+type Row struct {
+	Old *Line
+	New *Line
+}
+
+// Lines returns the line-by-line difference between `a` and `b`,
+// using Myers' O(ND) algorithm so that small edits to large texts stay cheap.
+func Lines(a, b string) []Line {
+	x, y := split(a), split(b)
+	n, m := len(x), len(y)
+	max := n + m
+
+	// `v[k+offset]` holds the furthest x reached on diagonal k;
+	// a copy is kept for each edit distance d so that the path can be traced back.
+	offset := max + 1
+	v := make([]int, 2*max+3)
+	var trace [][]int
+
+	for d := 0; d <= max; d++ {
+		trace = append(trace, append([]int(nil), v...))
+		done := false
+
+		for k := -d; k <= d; k += 2 {
+			var i int
+			if k == -d || (k != d && v[k-1+offset] < v[k+1+offset]) {
+				i = v[k+1+offset] // move down: insertion
+			} else {
+				i = v[k-1+offset] + 1 // move right: deletion
+			}
+			j := i - k
+			// Follow the diagonal as long as the lines match.
+			for i < n && j < m && x[i] == y[j] {
+				i++
+				j++
+			}
+			v[k+offset] = i
+			if i >= n && j >= m {
+				done = true
+				break
+			}
+		}
+
+		if done {
+			trace = append(trace, v)
+			break
+		}
+	}
+
+	return backtrack(trace, x, y, offset)
+}
+
+// Walk the saved traces backwards from (n, m) to (0, 0), collecting the edit script.
+func backtrack(trace [][]int, x, y []string, offset int) []Line {
+	i, j := len(x), len(y)
+	var lines []Line
+
+	for d := len(trace) - 2; d >= 0 && (i > 0 || j > 0); d-- {
+		v := trace[d]
+		k := i - j
+
+		var prevK int
+		if k == -d || (k != d && v[k-1+offset] < v[k+1+offset]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevI := v[prevK+offset]
+		prevJ := prevI - prevK
+
+		for i > prevI && j > prevJ {
+			i--
+			j--
+			lines = append(lines, Line{Op: Equal, Text: x[i], OldNum: i + 1, NewNum: j + 1})
+		}
+
+		if d > 0 {
+			if i == prevI {
+				j--
+				lines = append(lines, Line{Op: Insert, Text: y[j], NewNum: j + 1})
+			} else {
+				i--
+				lines = append(lines, Line{Op: Delete, Text: x[i], OldNum: i + 1})
+			}
+		}
+	}
+
+	// The lines were collected back to front.
+	for l, r := 0, len(lines)-1; l < r; l, r = l+1, r-1 {
+		lines[l], lines[r] = lines[r], lines[l]
+	}
+
+	return lines
+}
+
+// Hunks groups the changes in `lines` (as returned by `Lines`)
+// with up to `context` unchanged lines around them, like `diff -u` does.
+func Hunks(lines []Line, context int) []Hunk {
+	var hunks []Hunk
+
+	for i := 0; i < len(lines); {
+		// Skip to the next change.
+		if lines[i].Op == Equal {
+			i++
+			continue
+		}
+
+		start := max(i-context, 0)
+		end := i
+		// Extend the hunk while changes are close enough to share their context.
+		for end < len(lines) {
+			if lines[end].Op != Equal {
+				end++
+				continue
+			}
+			next := end
+			for next < len(lines) && lines[next].Op == Equal {
+				next++
+			}
+			if next == len(lines) || next-end > 2*context {
+				end = min(end+context, len(lines))
+				break
+			}
+			end = next
+		}
+
+		hunks = append(hunks, newHunk(lines[start:end]))
+		i = end
+	}
+
+	return hunks
+}
+
+func newHunk(lines []Line) Hunk {
+	h := Hunk{Lines: lines}
+	for _, l := range lines {
+		if l.Op != Insert {
+			if h.OldStart == 0 {
+				h.OldStart = l.OldNum
+			}
+			h.OldLines++
+		}
+		if l.Op != Delete {
+			if h.NewStart == 0 {
+				h.NewStart = l.NewNum
+			}
+			h.NewLines++
+		}
+	}
+	return h
+}
+
+// SideBySide arranges `lines` (as returned by `Lines`) into rows,
+// pairing up runs of deleted lines with the inserted lines that replaced them.
+func SideBySide(lines []Line) []Row {
+	var rows []Row
+
+	for i := 0; i < len(lines); {
+		if lines[i].Op == Equal {
+			rows = append(rows, Row{Old: &lines[i], New: &lines[i]})
+			i++
+			continue
+		}
+
+		var dels, ins []*Line
+		for ; i < len(lines) && lines[i].Op == Delete; i++ {
+			dels = append(dels, &lines[i])
+		}
+		for ; i < len(lines) && lines[i].Op == Insert; i++ {
+			ins = append(ins, &lines[i])
+		}
+
+		for n := 0; n < max(len(dels), len(ins)); n++ {
+			var row Row
+			if n < len(dels) {
+				row.Old = dels[n]
+			}
+			if n < len(ins) {
+				row.New = ins[n]
+			}
+			rows = append(rows, row)
+		}
+	}
+
+	return rows
+}
+
+// Split text into lines, ignoring a trailing newline and normalizing Windows line endings
+// (browsers submit textarea content with CRLF).
+func split(s string) []string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	s = strings.TrimSuffix(s, "\n")
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
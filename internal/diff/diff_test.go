@@ -0,0 +1,114 @@
+package diff
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/heschmat/MemoBin/internal/assert"
+)
+
+// Render lines the way `diff` does, e.g. " a\n-b\n+c\n", to make expectations easy to read.
+func render(lines []Line) string {
+	var b strings.Builder
+	for _, l := range lines {
+		switch l.Op {
+		case Equal:
+			b.WriteString(" ")
+		case Delete:
+			b.WriteString("-")
+		case Insert:
+			b.WriteString("+")
+		}
+		b.WriteString(l.Text + "\n")
+	}
+	return b.String()
+}
+
+func TestLines(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want string
+	}{
+		{
+			name: "Identical",
+			a:    "a\nb",
+			b:    "a\nb",
+			want: " a\n b\n",
+		},
+		{
+			name: "Empty",
+			a:    "",
+			b:    "",
+			want: "",
+		},
+		{
+			name: "All new",
+			a:    "",
+			b:    "a\nb",
+			want: "+a\n+b\n",
+		},
+		{
+			name: "All deleted",
+			a:    "a\nb",
+			b:    "",
+			want: "-a\n-b\n",
+		},
+		{
+			name: "Changed line",
+			a:    "a\nb\nc",
+			b:    "a\nx\nc",
+			want: " a\n-b\n+x\n c\n",
+		},
+		{
+			name: "CRLF",
+			a:    "a\r\nb\r\n",
+			b:    "a\nb\nc",
+			want: " a\n b\n+c\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, render(Lines(tt.a, tt.b)), tt.want)
+		})
+	}
+}
+
+func TestLineNumbers(t *testing.T) {
+	lines := Lines("a\nb\nc", "b\nc\nd")
+
+	assert.Equal(t, render(lines), "-a\n b\n c\n+d\n")
+	assert.Equal(t, lines[1].OldNum, 2)
+	assert.Equal(t, lines[1].NewNum, 1)
+	assert.Equal(t, lines[3].OldNum, 0)
+	assert.Equal(t, lines[3].NewNum, 3)
+}
+
+func TestHunks(t *testing.T) {
+	a := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10"
+	b := "1\nTWO\n3\n4\n5\n6\n7\n8\nNINE\n10"
+
+	hunks := Hunks(Lines(a, b), 1)
+
+	assert.Equal(t, len(hunks), 2)
+	assert.Equal(t, render(hunks[0].Lines), " 1\n-2\n+TWO\n 3\n")
+	assert.Equal(t, hunks[0].OldStart, 1)
+	assert.Equal(t, hunks[0].OldLines, 3)
+	assert.Equal(t, render(hunks[1].Lines), " 8\n-9\n+NINE\n 10\n")
+	assert.Equal(t, hunks[1].NewStart, 8)
+	assert.Equal(t, hunks[1].NewLines, 3)
+
+	// With enough context the two changes merge into one hunk.
+	assert.Equal(t, len(Hunks(Lines(a, b), 3)), 1)
+}
+
+func TestSideBySide(t *testing.T) {
+	rows := SideBySide(Lines("a\nb\nc", "a\nx\ny\nc"))
+
+	assert.Equal(t, len(rows), 4)
+	assert.Equal(t, rows[1].Old.Text, "b")
+	assert.Equal(t, rows[1].New.Text, "x")
+	assert.Equal(t, rows[2].Old == nil, true)
+	assert.Equal(t, rows[2].New.Text, "y")
+}
@@ -0,0 +1,210 @@
+// Package highlight renders code as HTML with syntax highlighting & line numbers, using chroma.
+// The HTML only refers to CSS classes; the colours come from the stylesheet of a theme (see `CSS()`),
+// which is served by the application itself, so pages don't depend on any third-party CDN.
+package highlight
+
+import (
+	"bytes"
+	"encoding/json"
+	"regexp"
+	"strings"
+
+	"github.com/alecthomas/chroma/v2"
+	"github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+)
+
+// A Language which memos can be highlighted as; `ID` is the name chroma knows it by.
+// `Extension` is the usual extension of its files, e.g. for downloads.
+type Language struct {
+	ID        string
+	Name      string
+	Extension string
+}
+
+// The language of content which isn't highlighted (but still gets line numbers).
+const Plaintext = "plaintext"
+
+// The languages offered in the memo form, by name.
+var Languages = []Language{
+	{Plaintext, "Plain text", ".txt"},
+	{"bash", "Bash", ".sh"},
+	{"c", "C", ".c"},
+	{"cpp", "C++", ".cpp"},
+	{"csharp", "C#", ".cs"},
+	{"css", "CSS", ".css"},
+	{"diff", "Diff", ".diff"},
+	{"docker", "Dockerfile", ".dockerfile"},
+	{"go", "Go", ".go"},
+	{"html", "HTML", ".html"},
+	{"java", "Java", ".java"},
+	{"javascript", "JavaScript", ".js"},
+	{"json", "JSON", ".json"},
+	{"kotlin", "Kotlin", ".kt"},
+	{"lua", "Lua", ".lua"},
+	{"makefile", "Makefile", ".mk"},
+	{"markdown", "Markdown", ".md"},
+	{"php", "PHP", ".php"},
+	{"python", "Python", ".py"},
+	{"ruby", "Ruby", ".rb"},
+	{"rust", "Rust", ".rs"},
+	{"sql", "SQL", ".sql"},
+	{"swift", "Swift", ".swift"},
+	{"toml", "TOML", ".toml"},
+	{"typescript", "TypeScript", ".ts"},
+	{"xml", "XML", ".xml"},
+	{"yaml", "YAML", ".yaml"},
+}
+
+// LanguageIDs returns the IDs of all `Languages`, e.g. for validating form input.
+func LanguageIDs() []string {
+	ids := make([]string, len(Languages))
+	for i, l := range Languages {
+		ids[i] = l.ID
+	}
+	return ids
+}
+
+// Look up the language with the given ID; unknown (or empty) IDs are plain text.
+func lookup(id string) Language {
+	for _, l := range Languages {
+		if l.ID == id {
+			return l
+		}
+	}
+	return Languages[0]
+}
+
+// LanguageName returns the name of the language with the given ID; unknown (or empty) IDs are plain text.
+func LanguageName(id string) string {
+	return lookup(id).Name
+}
+
+// Extension returns the file extension of the language with the given ID, e.g. ".py".
+func Extension(id string) string {
+	return lookup(id).Extension
+}
+
+// The themes which can be chosen for highlighted code; all of them are chroma styles.
+var Themes = []string{"github", "github-dark", "monokai", "dracula", "nord", "solarized-light", "solarized-dark"}
+
+// The theme used until the user picks another one.
+const DefaultTheme = "github"
+
+// Interpreters named on a script's `#!` line, and the language of the script.
+var interpreters = map[string]string{
+	"sh": "bash", "bash": "bash", "zsh": "bash", "ksh": "bash",
+	"python": "python", "python3": "python",
+	"node": "javascript", "deno": "typescript",
+	"ruby": "ruby", "php": "php", "lua": "lua",
+}
+
+var shebangRX = regexp.MustCompile(`^#!(?:\S*/)?([a-z]+)[0-9.]*(?:\s+([a-z]+)[0-9.]*)?`)
+
+// Telltale signs of languages, tried in order; the first match wins.
+var signatures = []struct {
+	language string
+	rx       *regexp.Regexp
+}{
+	{"php", regexp.MustCompile(`^<\?php`)},
+	{"xml", regexp.MustCompile(`^<\?xml`)},
+	{"html", regexp.MustCompile(`(?i)^(<!doctype html|<html)`)},
+	{"diff", regexp.MustCompile(`(?m)^(diff --git |--- \S.*\n\+\+\+ \S)`)},
+	{"go", regexp.MustCompile(`(?m)^package \w+$[\s\S]*^(func|import|type|var|const) `)},
+	{"rust", regexp.MustCompile(`(?m)^\s*(pub )?fn \w+\(|^use \w+(::\w+)+;`)},
+	{"cpp", regexp.MustCompile(`(?m)^#include\s*<\w+>$|\bstd::`)},
+	{"c", regexp.MustCompile(`(?m)^#include\s*[<"][\w/]+\.h[>"]`)},
+	{"java", regexp.MustCompile(`(?m)^(public |final )*class \w+|^import java\.`)},
+	{"csharp", regexp.MustCompile(`(?m)^using System[.;]|^namespace [\w.]+\s*[{;]?$`)},
+	{"python", regexp.MustCompile(`(?m)^(def|class) \w+.*:\s*$|^from [\w.]+ import |^import \w+$`)},
+	{"docker", regexp.MustCompile(`(?m)^FROM \S+[\s\S]*^(RUN|CMD|COPY|ENTRYPOINT) `)},
+	{"sql", regexp.MustCompile(`(?im)^\s*(SELECT\s[\s\S]+?\sFROM|INSERT INTO|UPDATE \w+ SET|DELETE FROM|CREATE (TABLE|INDEX)|ALTER TABLE)\b`)},
+	{"typescript", regexp.MustCompile(`(?m)^(export )?(interface|type) \w+.*[{=]|:\s*(string|number|boolean)\b`)},
+	{"javascript", regexp.MustCompile(`(?m)^(const|let|var) \w+ = |^function \w+\(|\bconsole\.log\(|=> \{`)},
+	{"yaml", regexp.MustCompile(`^---\n|^(\w[\w-]*:( .*)?\n)+\s*\w[\w-]*:`)},
+}
+
+// Detect guesses the language of `content`, for memos whose author didn't choose one.
+// Returns `Plaintext` if it can't tell.
+func Detect(content string) string {
+	content = strings.TrimLeft(strings.ReplaceAll(content, "\r\n", "\n"), "\n")
+
+	if m := shebangRX.FindStringSubmatch(content); m != nil {
+		// `#!/usr/bin/env python3` names the interpreter after `env`.
+		interpreter := m[1]
+		if interpreter == "env" {
+			interpreter = m[2]
+		}
+		if language, ok := interpreters[interpreter]; ok {
+			return language
+		}
+	}
+
+	if trimmed := strings.TrimSpace(content); strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[") {
+		if json.Valid([]byte(trimmed)) {
+			return "json"
+		}
+	}
+
+	for _, s := range signatures {
+		if s.rx.MatchString(content) {
+			return s.language
+		}
+	}
+
+	// Fall back on chroma's own analysers.
+	language, best := Plaintext, float32(0)
+	for _, l := range Languages {
+		if analyser, ok := lexers.Get(l.ID).(chroma.Analyser); ok {
+			if score := analyser.AnalyseText(content); score > best {
+				language, best = l.ID, score
+			}
+		}
+	}
+	return language
+}
+
+// The formatter shared by `HTML()` & `CSS()`: CSS classes instead of inline styles,
+// and line numbers in a separate column of a table, so copying the code doesn't copy them.
+// Every line number links to the line, e.g. "#L12".
+var formatter = html.New(
+	html.WithClasses(true),
+	html.WithLineNumbers(true),
+	html.LineNumbersInTable(true),
+	html.WithLinkableLineNumbers(true, "L"),
+	html.TabWidth(4),
+)
+
+// HTML renders `content` as highlighted HTML; unknown (or empty) languages are rendered as plain text.
+// Everything in `content` is escaped.
+func HTML(content, language string) (string, error) {
+	lexer := lexers.Get(language)
+	if lexer == nil || language == "" {
+		lexer = lexers.Get(Plaintext)
+	}
+	// Merge runs of tokens of the same type, for smaller HTML.
+	lexer = chroma.Coalesce(lexer)
+
+	iterator, err := lexer.Tokenise(nil, content)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	err = formatter.Format(&buf, styles.Get(DefaultTheme), iterator)
+	if err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// CSS returns the stylesheet of a theme (one of `Themes`) for the HTML rendered by `HTML()`.
+func CSS(theme string) ([]byte, error) {
+	var buf bytes.Buffer
+	err := formatter.WriteCSS(&buf, styles.Get(theme))
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,85 @@
+package highlight
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+
+	"github.com/heschmat/MemoBin/internal/assert"
+)
+
+// Every language & theme offered must be known to chroma.
+func TestRegistered(t *testing.T) {
+	for _, l := range Languages {
+		assert.Equal(t, lexers.Get(l.ID) != nil, true)
+	}
+	for _, theme := range Themes {
+		_, ok := styles.Registry[theme]
+		assert.Equal(t, ok, true)
+	}
+}
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"Shebang", "#!/bin/sh\necho hello", "bash"},
+		{"Env shebang", "#!/usr/bin/env python3\nprint('hello')", "python"},
+		{"Unknown shebang", "#!/usr/bin/awk -f\n{ print }", Plaintext},
+		{"JSON", `{"name": "memo", "tags": ["go"]}`, "json"},
+		{"Go", "package main\n\nimport \"fmt\"\n\nfunc main() {}", "go"},
+		{"Python", "import os\n\ndef main():\n    print(os.getcwd())", "python"},
+		{"SQL", "SELECT id, title\nFROM memos\nWHERE id = 1;", "sql"},
+		{"Diff", "--- a/memo.txt\n+++ b/memo.txt\n@@ -1 +1 @@\n-old\n+new", "diff"},
+		{"C", "#include <stdio.h>\n\nint main(void) { return 0; }", "c"},
+		{"C++", "#include <iostream>\n\nint main() { std::cout << 1; }", "cpp"},
+		{"HTML", "<!DOCTYPE html>\n<html></html>", "html"},
+		{"JavaScript", "const x = 1;\nconsole.log(x);", "javascript"},
+		{"Prose", "Remember to buy milk, eggs & bread.", Plaintext},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, Detect(tt.content), tt.want)
+		})
+	}
+}
+
+func TestHTML(t *testing.T) {
+	html, err := HTML("package main\n\n// <script>alert(1)</script>\n", "go")
+	assert.Equal(t, err, nil)
+	// The code is escaped, and highlighted with classes (not inline styles).
+	assert.Equal(t, strings.Contains(html, "<script>"), false)
+	assert.Equal(t, strings.Contains(html, "&lt;script&gt;"), true)
+	assert.Equal(t, strings.Contains(html, `<span class="kn">package</span>`), true)
+	assert.Equal(t, strings.Contains(html, "style="), false)
+	// One linkable number per line.
+	assert.Equal(t, strings.Contains(html, `id="L3"`), true)
+	assert.Equal(t, strings.Contains(html, `id="L4"`), false)
+
+	// Unknown languages are plain text.
+	html, err = HTML("package main", "nonsense")
+	assert.Equal(t, err, nil)
+	assert.Equal(t, strings.Contains(html, `class="kn"`), false)
+	assert.Equal(t, strings.Contains(html, "package main"), true)
+}
+
+func TestCSS(t *testing.T) {
+	css, err := CSS("monokai")
+	assert.Equal(t, err, nil)
+	assert.Equal(t, strings.Contains(string(css), ".chroma"), true)
+}
+
+func TestLanguageName(t *testing.T) {
+	assert.Equal(t, LanguageName("cpp"), "C++")
+	assert.Equal(t, LanguageName(""), "Plain text")
+}
+
+func TestExtension(t *testing.T) {
+	assert.Equal(t, Extension("python"), ".py")
+	assert.Equal(t, Extension("nonsense"), ".txt")
+}
@@ -0,0 +1,48 @@
+// Package markdown renders Markdown memos to HTML which is safe to embed in a page.
+// It supports GitHub Flavored Markdown (tables, task lists, strikethrough, autolinks)
+// and highlights fenced code blocks with the same CSS classes as `internal/highlight`.
+package markdown
+
+import (
+	"bytes"
+	"regexp"
+
+	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	highlighting "github.com/yuin/goldmark-highlighting/v2"
+	"github.com/yuin/goldmark/extension"
+)
+
+// Raw HTML in the source is never rendered (goldmark omits it unless told otherwise),
+// so the only HTML in the output is the one generated from the Markdown.
+var converter = goldmark.New(
+	goldmark.WithExtensions(
+		extension.GFM,
+		highlighting.NewHighlighting(
+			// CSS classes rather than inline styles: the colours come from the theme's stylesheet.
+			highlighting.WithFormatOptions(chromahtml.WithClasses(true)),
+		),
+	),
+)
+
+// Links & images can still point anywhere (e.g. "javascript:" URLs), so the HTML is sanitized as well.
+// On top of what's safe in user-generated content, keep the classes of highlighted code
+// and the checkboxes of task lists.
+var policy = func() *bluemonday.Policy {
+	p := bluemonday.UGCPolicy()
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^[\w -]+$`)).OnElements("pre", "code", "span")
+	p.AllowAttrs("type").Matching(regexp.MustCompile(`^checkbox$`)).OnElements("input")
+	p.AllowAttrs("checked", "disabled").OnElements("input")
+	return p
+}()
+
+// Render converts Markdown to sanitized HTML.
+func Render(source string) (string, error) {
+	var buf bytes.Buffer
+	err := converter.Convert([]byte(source), &buf)
+	if err != nil {
+		return "", err
+	}
+	return policy.Sanitize(buf.String()), nil
+}
@@ -0,0 +1,69 @@
+package markdown
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/heschmat/MemoBin/internal/assert"
+)
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name    string
+		source  string
+		want    []string
+		notWant []string
+	}{
+		{
+			name:   "Heading",
+			source: "# Title\n\nSome *text*.",
+			want:   []string{"<h1>Title</h1>", "<em>text</em>"},
+		},
+		{
+			name:   "Table",
+			source: "| a | b |\n|---|---|\n| 1 | 2 |",
+			want:   []string{"<table>", "<th>a</th>", "<td>2</td>"},
+		},
+		{
+			name:   "Task list",
+			source: "- [x] done\n- [ ] todo",
+			want:   []string{`<input checked="" disabled="" type="checkbox"`, `<input disabled="" type="checkbox"`},
+		},
+		{
+			name:    "Highlighted code",
+			source:  "```go\npackage main\n```",
+			want:    []string{`<pre class="chroma">`, `<span class="kn">package</span>`},
+			notWant: []string{"style="},
+		},
+		{
+			name:    "Raw HTML",
+			source:  "<script>alert(1)</script>\n\nHello <b onclick=\"alert(1)\">there</b>",
+			want:    []string{"Hello"},
+			notWant: []string{"<script", "alert", "<b"},
+		},
+		{
+			name:    "JavaScript link",
+			source:  "[click](javascript:alert(1)) ![img](javascript:alert(2))",
+			want:    []string{"click"},
+			notWant: []string{"javascript:"},
+		},
+		{
+			name:   "Autolink",
+			source: "See https://example.com",
+			want:   []string{`<a href="https://example.com" rel="nofollow">`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			html, err := Render(tt.source)
+			assert.Equal(t, err, nil)
+			for _, s := range tt.want {
+				assert.Equal(t, strings.Contains(html, s), true)
+			}
+			for _, s := range tt.notWant {
+				assert.Equal(t, strings.Contains(html, s), false)
+			}
+		})
+	}
+}
@@ -0,0 +1,379 @@
+// Package migrations applies the versioned schema changes embedded in the binary.
+//
+// Each supported database has a directory of migration files named
+// `<version>_<name>.up.sql` (applying the change) and `<version>_<name>.down.sql` (reverting it).
+// Applied versions are recorded in the *schema_migrations* table.
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed mysql/*.sql postgres/*.sql sqlite/*.sql
+var files embed.FS
+
+// A `Migration` is a single, versioned schema change.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string // Empty if the migration can't be reverted.
+}
+
+// The `Status` of a migration: when it was applied (zero if it's still pending).
+type Status struct {
+	Migration
+	Applied time.Time
+}
+
+// The bits which differ between databases, by name (the same as `models.Dialect.Name`).
+type dialect struct {
+	// Creates the table recording the applied versions.
+	createTable string
+
+	// Run on a single connection before & after migrating, so that only one instance migrates at a time.
+	// SQLite has no such lock, but each migration runs in a transaction which locks the whole database
+	// (with `_txlock=immediate`), and it's checked again whether it's still pending once that's acquired.
+	lock, unlock string
+
+	// Whether placeholders are numbered (`$1`) rather than `?`.
+	numberedParams bool
+}
+
+var dialects = map[string]dialect{
+	"mysql": {
+		createTable: `CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER NOT NULL PRIMARY KEY,
+			applied DATETIME NOT NULL
+		);`,
+		// GET_LOCK() returns 1 once the lock is acquired, or 0 after waiting for 60 seconds.
+		lock:   `SELECT GET_LOCK('memobin_migrations', 60);`,
+		unlock: `SELECT RELEASE_LOCK('memobin_migrations');`,
+	},
+	"postgres": {
+		createTable: `CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER NOT NULL PRIMARY KEY,
+			applied TIMESTAMP NOT NULL
+		);`,
+		// An arbitrary, but fixed, key for the advisory lock; returns 1 once acquired.
+		lock:           `SELECT 1 FROM pg_advisory_lock(72740512);`,
+		unlock:         `SELECT pg_advisory_unlock(72740512);`,
+		numberedParams: true,
+	},
+	"sqlite": {
+		createTable: `CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER NOT NULL PRIMARY KEY,
+			applied DATETIME NOT NULL
+		);`,
+	},
+}
+
+// e.g. 0002_create_memos.up.sql
+var fileRX = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// A `Migrator` applies & reverts the migrations of one database.
+type Migrator struct {
+	db         *sql.DB
+	dialect    dialect
+	migrations []Migration // sorted by version
+}
+
+// Create a migrator for `db`; `dialectName` is one of "mysql", "postgres" or "sqlite".
+func New(db *sql.DB, dialectName string) (*Migrator, error) {
+	d, ok := dialects[dialectName]
+	if !ok {
+		return nil, fmt.Errorf("migrations: unsupported database %q", dialectName)
+	}
+
+	migrations, err := load(dialectName)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{db: db, dialect: d, migrations: migrations}, nil
+}
+
+// Read the migration files of a dialect, sorted by version.
+func load(dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(files, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		matches := fileRX.FindStringSubmatch(entry.Name())
+		if matches == nil {
+			return nil, fmt.Errorf("migrations: unexpected file %s/%s", dir, entry.Name())
+		}
+
+		version, _ := strconv.Atoi(matches[1])
+		b, err := fs.ReadFile(files, dir+"/"+entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: matches[2]}
+			byVersion[version] = m
+		}
+		if m.Name != matches[2] {
+			return nil, fmt.Errorf("migrations: version %d of %s has two names", version, dir)
+		}
+
+		if matches[3] == "up" {
+			m.Up = string(b)
+		} else {
+			m.Down = string(b)
+		}
+	}
+
+	var migrations []Migration
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migrations: version %d of %s has no up migration", m.Version, dir)
+		}
+		migrations = append(migrations, *m)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Apply all pending migrations, oldest first, and return them.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var applied []Migration
+
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		versions, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			if _, ok := versions[migration.Version]; ok {
+				continue
+			}
+
+			ok, err := m.apply(ctx, conn, migration, true)
+			if err != nil {
+				return err
+			}
+			if ok {
+				applied = append(applied, migration)
+			}
+		}
+		return nil
+	})
+
+	return applied, err
+}
+
+// Revert the last `steps` applied migrations, newest first, and return them.
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	var reverted []Migration
+
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		versions, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(m.migrations) - 1; i >= 0 && len(reverted) < steps; i-- {
+			migration := m.migrations[i]
+			if _, ok := versions[migration.Version]; !ok {
+				continue
+			}
+
+			if migration.Down == "" {
+				return fmt.Errorf("migrations: %04d_%s can't be reverted", migration.Version, migration.Name)
+			}
+
+			ok, err := m.apply(ctx, conn, migration, false)
+			if err != nil {
+				return err
+			}
+			if ok {
+				reverted = append(reverted, migration)
+			}
+		}
+		return nil
+	})
+
+	return reverted, err
+}
+
+// Return the status of every migration, oldest first.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	_, err = conn.ExecContext(ctx, m.dialect.createTable)
+	if err != nil {
+		return nil, err
+	}
+
+	versions, err := appliedVersions(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, len(m.migrations))
+	for i, migration := range m.migrations {
+		statuses[i] = Status{Migration: migration, Applied: versions[migration.Version]}
+	}
+	return statuses, nil
+}
+
+// Run `fn` on a single connection while holding the migration lock.
+func (m *Migrator) locked(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if m.dialect.lock != "" {
+		var acquired sql.NullInt64
+		err = conn.QueryRowContext(ctx, m.dialect.lock).Scan(&acquired)
+		if err != nil {
+			return err
+		}
+		if acquired.Int64 != 1 {
+			return errors.New("migrations: timed out waiting for another instance to finish migrating")
+		}
+
+		// N.B. Not bound to `ctx`: the lock must be released even if it was cancelled.
+		defer conn.ExecContext(context.Background(), m.dialect.unlock)
+	}
+
+	_, err = conn.ExecContext(ctx, m.dialect.createTable)
+	if err != nil {
+		return err
+	}
+
+	return fn(conn)
+}
+
+// Apply (`up`) or revert a single migration in a transaction.
+// Returns false if another instance got there first.
+// N.B. MySQL commits schema changes implicitly, so there a failed migration may be half-applied.
+func (m *Migrator) apply(ctx context.Context, conn *sql.Conn, migration Migration, up bool) (bool, error) {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var n int
+	err = tx.QueryRowContext(ctx, m.rebind(`SELECT COUNT(*) FROM schema_migrations WHERE version = ?;`),
+		migration.Version).Scan(&n)
+	if err != nil {
+		return false, err
+	}
+	// Applied or reverted by another instance since we looked.
+	pending := n == 0
+	if pending != up {
+		return false, nil
+	}
+
+	script, record := migration.Down, `DELETE FROM schema_migrations WHERE version = ?;`
+	args := []any{migration.Version}
+	if up {
+		script, record = migration.Up, `INSERT INTO schema_migrations (version, applied) VALUES (?, ?);`
+		args = append(args, time.Now().UTC().Truncate(time.Second))
+	}
+
+	for _, stmt := range splitStatements(script) {
+		_, err = tx.ExecContext(ctx, stmt)
+		if err != nil {
+			return false, fmt.Errorf("migrations: %04d_%s: %w", migration.Version, migration.Name, err)
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, m.rebind(record), args...)
+	if err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+// Return the applied versions & when they were applied.
+func appliedVersions(ctx context.Context, conn *sql.Conn) (map[int]time.Time, error) {
+	rows, err := conn.QueryContext(ctx, `SELECT version, applied FROM schema_migrations;`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var applied time.Time
+		err = rows.Scan(&version, &applied)
+		if err != nil {
+			return nil, err
+		}
+		versions[version] = applied
+	}
+
+	return versions, rows.Err()
+}
+
+// Rewrite `?` placeholders as `$1`, `$2`, ... where needed.
+func (m *Migrator) rebind(query string) string {
+	if !m.dialect.numberedParams {
+		return query
+	}
+
+	parts := strings.Split(query, "?")
+	for i := 1; i < len(parts); i++ {
+		parts[i] = "$" + strconv.Itoa(i) + parts[i]
+	}
+	return strings.Join(parts, "")
+}
+
+// A statement creating a trigger, whose body (between BEGIN & END) contains statements of its own.
+var triggerRX = regexp.MustCompile(`(?im)^\s*CREATE\s+TRIGGER\b`)
+
+// Split a migration file into its statements, which must each end with a semicolon at the end of a line.
+// (Not every driver can execute several statements at once.)
+// Triggers end with `END;`, the statements of their body are kept together with them.
+func splitStatements(script string) []string {
+	var stmts []string
+	stmt := ""
+	for _, chunk := range strings.SplitAfter(script, ";\n") {
+		stmt += chunk
+		if triggerRX.MatchString(stmt) && !strings.HasSuffix(strings.ToUpper(strings.TrimSpace(stmt)), "END;") {
+			continue
+		}
+
+		// Skip what's left after the last statement, if it's only comments & whitespace.
+		code := false
+		for _, line := range strings.Split(stmt, "\n") {
+			line = strings.TrimSpace(line)
+			code = code || (line != "" && !strings.HasPrefix(line, "--"))
+		}
+
+		if code {
+			stmts = append(stmts, strings.TrimSpace(stmt))
+		}
+		stmt = ""
+	}
+	return stmts
+}
@@ -0,0 +1,167 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/heschmat/MemoBin/internal/assert"
+
+	_ "modernc.org/sqlite"
+)
+
+// Open a fresh SQLite database, the same way the application does.
+func newTestDB(t *testing.T, path string) *sql.DB {
+	db, err := sql.Open("sqlite", path+"?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_txlock=immediate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func newTestMigrator(t *testing.T, db *sql.DB) *Migrator {
+	m, err := New(db, "sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+// The names of the tables in a SQLite database.
+func tables(t *testing.T, db *sql.DB) map[string]bool {
+	rows, err := db.Query(`SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%';`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	names := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			t.Fatal(err)
+		}
+		names[name] = true
+	}
+	return names
+}
+
+func TestLoad(t *testing.T) {
+	for name := range dialects {
+		t.Run(name, func(t *testing.T) {
+			migrations, err := load(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Every database gets the same changes, in the same order.
+			assert.Equal(t, len(migrations), 10)
+			for i, m := range migrations {
+				assert.Equal(t, m.Version, i+1)
+				assert.Equal(t, m.Down != "", true)
+			}
+			assert.Equal(t, migrations[1].Name, "create_memos")
+		})
+	}
+}
+
+func TestUpDown(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t, filepath.Join(t.TempDir(), "test.db"))
+	m := newTestMigrator(t, db)
+
+	applied, err := m.Up(ctx)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(applied), 10)
+	assert.Equal(t, tables(t, db)["memos"], true)
+
+	// Nothing left to do.
+	applied, err = m.Up(ctx)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(applied), 0)
+
+	statuses, err := m.Status(ctx)
+	assert.Equal(t, err, nil)
+	for _, s := range statuses {
+		assert.Equal(t, s.Applied.IsZero(), false)
+	}
+
+	reverted, err := m.Down(ctx, 7)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(reverted), 7)
+	assert.Equal(t, reverted[6].Name, "create_sessions")
+	assert.Equal(t, tables(t, db)["sessions"], false)
+
+	statuses, err = m.Status(ctx)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, statuses[2].Applied.IsZero(), false)
+	assert.Equal(t, statuses[3].Applied.IsZero(), true)
+
+	reverted, err = m.Down(ctx, 10)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(reverted), 3)
+	assert.Equal(t, len(tables(t, db)), 1) // only schema_migrations is left
+}
+
+// Two instances starting at the same time must apply each migration exactly once.
+func TestConcurrentUp(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	migrators := []*Migrator{
+		newTestMigrator(t, newTestDB(t, path)),
+		newTestMigrator(t, newTestDB(t, path)),
+	}
+
+	var wg sync.WaitGroup
+	counts := make([]int, len(migrators))
+	errs := make([]error, len(migrators))
+	for i, m := range migrators {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			applied, err := m.Up(context.Background())
+			counts[i], errs[i] = len(applied), err
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, errs[0], nil)
+	assert.Equal(t, errs[1], nil)
+	assert.Equal(t, counts[0]+counts[1], 10)
+}
+
+func TestSplitStatements(t *testing.T) {
+	script := `-- A comment.
+CREATE TABLE a (
+    id INTEGER -- trailing comment
+);
+
+CREATE INDEX idx_a ON a(id);
+-- Nothing after this.
+`
+	stmts := splitStatements(script)
+
+	assert.Equal(t, len(stmts), 2)
+	assert.Equal(t, stmts[1], "CREATE INDEX idx_a ON a(id);")
+}
+
+func TestSplitStatementsTrigger(t *testing.T) {
+	script := `CREATE TABLE a (id INTEGER);
+
+-- Keep b in sync.
+CREATE TRIGGER a_insert AFTER INSERT ON a BEGIN
+    INSERT INTO b VALUES (new.id);
+    INSERT INTO c VALUES (new.id);
+END;
+
+DROP TABLE d;
+`
+	stmts := splitStatements(script)
+
+	assert.Equal(t, len(stmts), 3)
+	assert.Equal(t, strings.HasSuffix(stmts[1], "INSERT INTO c VALUES (new.id);\nEND;"), true)
+	assert.Equal(t, stmts[2], "DROP TABLE d;")
+}
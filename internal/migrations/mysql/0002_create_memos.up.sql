@@ -0,0 +1,21 @@
+CREATE TABLE IF NOT EXISTS memos (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    slug CHAR(12) NOT NULL,
+    user_id INTEGER NOT NULL,
+    title VARCHAR(100) NOT NULL,
+    content TEXT NOT NULL,
+    created DATETIME NOT NULL,
+    expires DATETIME NULL,
+    version INTEGER NOT NULL DEFAULT 1,
+    updated DATETIME NOT NULL,
+    deleted DATETIME NULL,
+    burn_after_reading BOOLEAN NOT NULL DEFAULT FALSE,
+    hashed_password CHAR(60) NULL,
+    visibility ENUM('public', 'unlisted', 'private') NOT NULL DEFAULT 'public',
+    legacy_id INTEGER NULL,
+    INDEX idx_memos_created (created),
+    INDEX idx_memos_user_deleted (user_id, deleted),
+    CONSTRAINT memos_uc_slug UNIQUE (slug),
+    CONSTRAINT memos_uc_legacy_id UNIQUE (legacy_id),
+    CONSTRAINT memos_fk_user FOREIGN KEY (user_id) REFERENCES users(id)
+);
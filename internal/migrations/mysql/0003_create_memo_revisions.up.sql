@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS memo_revisions (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    memo_id INTEGER NOT NULL,
+    version INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    title VARCHAR(100) NOT NULL,
+    content TEXT NOT NULL,
+    created DATETIME NOT NULL,
+    CONSTRAINT memo_revisions_uc_version UNIQUE (memo_id, version),
+    CONSTRAINT memo_revisions_fk_memo FOREIGN KEY (memo_id) REFERENCES memos(id) ON DELETE CASCADE,
+    CONSTRAINT memo_revisions_fk_user FOREIGN KEY (user_id) REFERENCES users(id)
+);
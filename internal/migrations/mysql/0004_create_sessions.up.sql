@@ -0,0 +1,7 @@
+-- Used by the session store (github.com/alexedwards/scs/mysqlstore).
+CREATE TABLE IF NOT EXISTS sessions (
+    token CHAR(43) PRIMARY KEY,
+    data BLOB NOT NULL,
+    expiry TIMESTAMP(6) NOT NULL,
+    INDEX sessions_expiry_idx (expiry)
+);
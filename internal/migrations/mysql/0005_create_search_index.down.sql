@@ -0,0 +1 @@
+ALTER TABLE memos DROP INDEX idx_memos_fulltext;
@@ -0,0 +1,2 @@
+-- Full-text search over the title & content of memos.
+ALTER TABLE memos ADD FULLTEXT INDEX idx_memos_fulltext (title, content);
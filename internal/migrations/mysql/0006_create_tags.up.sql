@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS tags (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    name VARCHAR(30) NOT NULL,
+    CONSTRAINT tags_uc_name UNIQUE (name)
+);
+
+-- Which memos have which tags.
+CREATE TABLE IF NOT EXISTS memo_tags (
+    memo_id INTEGER NOT NULL,
+    tag_id INTEGER NOT NULL,
+    PRIMARY KEY (memo_id, tag_id),
+    INDEX idx_memo_tags_tag (tag_id),
+    CONSTRAINT memo_tags_fk_memo FOREIGN KEY (memo_id) REFERENCES memos(id) ON DELETE CASCADE,
+    CONSTRAINT memo_tags_fk_tag FOREIGN KEY (tag_id) REFERENCES tags(id) ON DELETE CASCADE
+);
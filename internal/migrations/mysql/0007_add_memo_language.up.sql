@@ -0,0 +1,2 @@
+-- The language memos are highlighted as (see internal/highlight); empty for plain text.
+ALTER TABLE memos ADD COLUMN language VARCHAR(30) NOT NULL DEFAULT '';
@@ -0,0 +1,11 @@
+-- Tokens authenticating command-line clients (e.g. `curl`) instead of a session.
+-- Only the SHA-256 hash of a token is stored; the token itself is shown to its owner once.
+CREATE TABLE IF NOT EXISTS tokens (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    user_id INTEGER NOT NULL,
+    hash CHAR(64) NOT NULL,
+    created DATETIME NOT NULL,
+    INDEX idx_tokens_user (user_id),
+    CONSTRAINT tokens_uc_hash UNIQUE (hash),
+    CONSTRAINT tokens_fk_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
@@ -0,0 +1,4 @@
+ALTER TABLE tokens
+    DROP COLUMN name,
+    DROP COLUMN scope,
+    DROP COLUMN last_used;
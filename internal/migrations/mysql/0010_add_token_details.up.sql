@@ -0,0 +1,6 @@
+-- Users can have several tokens, told apart by their names, and each may only read or also write.
+-- Tokens created before keep working as they did (they could create memos).
+ALTER TABLE tokens
+    ADD COLUMN name VARCHAR(100) NOT NULL DEFAULT 'Command line',
+    ADD COLUMN scope ENUM('read', 'write') NOT NULL DEFAULT 'write',
+    ADD COLUMN last_used DATETIME NULL;
@@ -0,0 +1,21 @@
+CREATE TABLE IF NOT EXISTS memos (
+    id INTEGER GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    slug CHAR(12) NOT NULL,
+    user_id INTEGER NOT NULL REFERENCES users(id),
+    title VARCHAR(100) NOT NULL,
+    content TEXT NOT NULL,
+    created TIMESTAMP NOT NULL,
+    expires TIMESTAMP NULL,
+    version INTEGER NOT NULL DEFAULT 1,
+    updated TIMESTAMP NOT NULL,
+    deleted TIMESTAMP NULL,
+    burn_after_reading BOOLEAN NOT NULL DEFAULT FALSE,
+    hashed_password CHAR(60) NULL,
+    visibility TEXT NOT NULL DEFAULT 'public' CHECK (visibility IN ('public', 'unlisted', 'private')),
+    legacy_id INTEGER NULL,
+    CONSTRAINT memos_uc_slug UNIQUE (slug),
+    CONSTRAINT memos_uc_legacy_id UNIQUE (legacy_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_memos_created ON memos(created);
+CREATE INDEX IF NOT EXISTS idx_memos_user_deleted ON memos(user_id, deleted);
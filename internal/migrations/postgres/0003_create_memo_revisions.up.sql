@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS memo_revisions (
+    id INTEGER GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    memo_id INTEGER NOT NULL REFERENCES memos(id) ON DELETE CASCADE,
+    version INTEGER NOT NULL,
+    user_id INTEGER NOT NULL REFERENCES users(id),
+    title VARCHAR(100) NOT NULL,
+    content TEXT NOT NULL,
+    created TIMESTAMP NOT NULL,
+    CONSTRAINT memo_revisions_uc_version UNIQUE (memo_id, version)
+);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_memos_search_vector;
+ALTER TABLE memos DROP COLUMN IF EXISTS search_vector;
@@ -0,0 +1,6 @@
+-- Full-text search over the title & content of memos; matches in the title rank higher.
+ALTER TABLE memos ADD COLUMN IF NOT EXISTS search_vector tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector('simple', title), 'A') || setweight(to_tsvector('simple', content), 'B')
+) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_memos_search_vector ON memos USING GIN (search_vector);
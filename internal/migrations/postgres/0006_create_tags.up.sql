@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS tags (
+    id INTEGER GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    name VARCHAR(30) NOT NULL,
+    CONSTRAINT tags_uc_name UNIQUE (name)
+);
+
+-- Which memos have which tags.
+CREATE TABLE IF NOT EXISTS memo_tags (
+    memo_id INTEGER NOT NULL REFERENCES memos(id) ON DELETE CASCADE,
+    tag_id INTEGER NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+    PRIMARY KEY (memo_id, tag_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_memo_tags_tag ON memo_tags(tag_id);
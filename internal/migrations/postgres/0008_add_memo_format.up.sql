@@ -0,0 +1,2 @@
+-- How the content of memos is rendered: as (highlighted) plain text or as Markdown.
+ALTER TABLE memos ADD COLUMN format TEXT NOT NULL DEFAULT 'plain' CHECK (format IN ('plain', 'markdown'));
@@ -0,0 +1,11 @@
+-- Tokens authenticating command-line clients (e.g. `curl`) instead of a session.
+-- Only the SHA-256 hash of a token is stored; the token itself is shown to its owner once.
+CREATE TABLE IF NOT EXISTS tokens (
+    id INTEGER GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    hash CHAR(64) NOT NULL,
+    created TIMESTAMP NOT NULL,
+    CONSTRAINT tokens_uc_hash UNIQUE (hash)
+);
+
+CREATE INDEX IF NOT EXISTS idx_tokens_user ON tokens(user_id);
@@ -0,0 +1,3 @@
+ALTER TABLE tokens DROP COLUMN last_used;
+ALTER TABLE tokens DROP COLUMN scope;
+ALTER TABLE tokens DROP COLUMN name;
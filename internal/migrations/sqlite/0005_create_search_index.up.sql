@@ -0,0 +1,19 @@
+-- Full-text search over the title & content of memos.
+-- An external content FTS5 table: it only stores the index, and triggers keep it in sync with *memos*.
+CREATE VIRTUAL TABLE IF NOT EXISTS memos_fts USING fts5(title, content, content='memos', content_rowid='id');
+
+-- Index the memos which already exist.
+INSERT INTO memos_fts(memos_fts) VALUES ('rebuild');
+
+CREATE TRIGGER IF NOT EXISTS memos_fts_insert AFTER INSERT ON memos BEGIN
+    INSERT INTO memos_fts(rowid, title, content) VALUES (new.id, new.title, new.content);
+END;
+
+CREATE TRIGGER IF NOT EXISTS memos_fts_delete AFTER DELETE ON memos BEGIN
+    INSERT INTO memos_fts(memos_fts, rowid, title, content) VALUES ('delete', old.id, old.title, old.content);
+END;
+
+CREATE TRIGGER IF NOT EXISTS memos_fts_update AFTER UPDATE OF title, content ON memos BEGIN
+    INSERT INTO memos_fts(memos_fts, rowid, title, content) VALUES ('delete', old.id, old.title, old.content);
+    INSERT INTO memos_fts(rowid, title, content) VALUES (new.id, new.title, new.content);
+END;
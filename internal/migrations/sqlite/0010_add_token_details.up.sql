@@ -0,0 +1,5 @@
+-- Users can have several tokens, told apart by their names, and each may only read or also write.
+-- Tokens created before keep working as they did (they could create memos).
+ALTER TABLE tokens ADD COLUMN name VARCHAR(100) NOT NULL DEFAULT 'Command line';
+ALTER TABLE tokens ADD COLUMN scope TEXT NOT NULL DEFAULT 'write' CHECK (scope IN ('read', 'write'));
+ALTER TABLE tokens ADD COLUMN last_used DATETIME NULL;
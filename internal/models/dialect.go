@@ -0,0 +1,139 @@
+package models
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// A `Dialect` holds the bits of SQL which differ between the databases we support.
+// Everything else is written in the common subset (no `UTC_TIMESTAMP()`, `DATE_SUB()` & co.;
+// timestamps are computed in Go and passed as parameters instead).
+type Dialect struct {
+	Name string
+
+	// Whether placeholders are numbered (`$1`, `$2`, ...) rather than `?`.
+	// Queries are always written with `?` and rewritten by `rebind()`.
+	numberedParams bool
+
+	// Appended to SELECTs which lock the selected rows until the end of the transaction.
+	// Empty for SQLite, where a write transaction locks the whole database anyway.
+	lockRows string
+
+	// Reports whether `err` is a violation of a unique constraint.
+	isDuplicate func(err error) bool
+
+	// Deletes up to `?` expired rows from the *sessions* table of the session store.
+	deleteExpiredSessions string
+
+	// Adds the tag `?` to the *tags* table, unless it's there already.
+	insertTag string
+
+	// Full-text search of memos (see `MemoModel.Search()`): joined to *memos*, the condition matching
+	// the search & the ORDER BY expression ranking the results, best first.
+	// Each `?` in `searchMatch` & `searchRank` is bound to the search expression built by `searchExpr()`.
+	searchJoin, searchMatch, searchRank string
+	searchExpr                          func(terms []string) string
+}
+
+var (
+	MySQL = &Dialect{
+		Name:     "mysql",
+		lockRows: " FOR UPDATE",
+		isDuplicate: func(err error) bool {
+			var mySQLError *mysql.MySQLError
+			// 1062: ER_DUP_ENTRY
+			return errors.As(err, &mySQLError) && mySQLError.Number == 1062
+		},
+		deleteExpiredSessions: `DELETE FROM sessions WHERE expiry < UTC_TIMESTAMP(6) LIMIT ?;`,
+		insertTag:             `INSERT IGNORE INTO tags (name) VALUES (?);`,
+		// Uses the FULLTEXT index on (title, content); in boolean mode, `+` makes every term required.
+		// N.B. InnoDB doesn't index words shorter than `innodb_ft_min_token_size` (3) or its stopwords.
+		searchMatch: `MATCH(m.title, m.content) AGAINST (? IN BOOLEAN MODE)`,
+		searchRank:  `MATCH(m.title, m.content) AGAINST (? IN BOOLEAN MODE) DESC`,
+		searchExpr: func(terms []string) string {
+			return "+" + strings.Join(terms, " +")
+		},
+	}
+
+	SQLite = &Dialect{
+		Name: "sqlite",
+		isDuplicate: func(err error) bool {
+			// Checked through an interface, so this package doesn't depend on the driver.
+			var sqliteError interface{ Code() int }
+			// 2067: SQLITE_CONSTRAINT_UNIQUE, 1555: SQLITE_CONSTRAINT_PRIMARYKEY
+			return errors.As(err, &sqliteError) && (sqliteError.Code() == 2067 || sqliteError.Code() == 1555)
+		},
+		// The sqlite3store keeps expiry dates as Julian day numbers.
+		deleteExpiredSessions: `DELETE FROM sessions WHERE token IN
+		(SELECT token FROM sessions WHERE expiry < julianday('now') LIMIT ?);`,
+		insertTag: `INSERT INTO tags (name) VALUES (?) ON CONFLICT (name) DO NOTHING;`,
+		// The FTS5 table *memos_fts* is kept up to date by triggers. A list of quoted terms matches
+		// rows containing all of them; bm25() is lower for better matches, and weighs the title 3x.
+		searchJoin:  ` INNER JOIN memos_fts ON memos_fts.rowid = m.id`,
+		searchMatch: `memos_fts MATCH ?`,
+		searchRank:  `bm25(memos_fts, 3.0, 1.0)`,
+		searchExpr: func(terms []string) string {
+			return `"` + strings.Join(terms, `" "`) + `"`
+		},
+	}
+
+	Postgres = &Dialect{
+		Name:           "postgres",
+		numberedParams: true,
+		lockRows:       " FOR UPDATE",
+		isDuplicate: func(err error) bool {
+			// Both pgx & lib/pq errors report their SQLSTATE this way.
+			var pgError interface{ SQLState() string }
+			// 23505: unique_violation
+			return errors.As(err, &pgError) && pgError.SQLState() == "23505"
+		},
+		deleteExpiredSessions: `DELETE FROM sessions WHERE token IN
+		(SELECT token FROM sessions WHERE expiry < current_timestamp LIMIT ?);`,
+		insertTag: `INSERT INTO tags (name) VALUES (?) ON CONFLICT (name) DO NOTHING;`,
+		// `search_vector` is a generated column with a GIN index, the title weighted above the content.
+		// plainto_tsquery() matches rows containing all the words.
+		searchMatch: `m.search_vector @@ plainto_tsquery('simple', ?)`,
+		searchRank:  `ts_rank(m.search_vector, plainto_tsquery('simple', ?)) DESC`,
+		searchExpr: func(terms []string) string {
+			return strings.Join(terms, " ")
+		},
+	}
+)
+
+// Return `d`, or MySQL if it's nil, so models created as `&MemoModel{DB: db}` keep working.
+func (d *Dialect) orDefault() *Dialect {
+	if d == nil {
+		return MySQL
+	}
+	return d
+}
+
+// The current time as stored in the database: UTC, to the second.
+// N.B. Timestamps are computed here rather than with `UTC_TIMESTAMP()`,
+// so every backend (including the in-memory one) agrees on them.
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Second)
+}
+
+// Rewrite the `?` placeholders of `query` for the database, e.g. to `$1`, `$2`, ... for PostgreSQL.
+// N.B. Queries mustn't contain a literal `?`.
+func (d *Dialect) rebind(query string) string {
+	if !d.orDefault().numberedParams {
+		return query
+	}
+
+	var b strings.Builder
+	n := 0
+	for _, part := range strings.Split(query, "?") {
+		if n > 0 {
+			b.WriteString("$" + strconv.Itoa(n))
+		}
+		b.WriteString(part)
+		n++
+	}
+	return b.String()
+}
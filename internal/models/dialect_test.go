@@ -0,0 +1,67 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/heschmat/MemoBin/internal/assert"
+)
+
+func TestRebind(t *testing.T) {
+	tests := []struct {
+		name    string
+		dialect *Dialect
+		query   string
+		want    string
+	}{
+		{"MySQL", MySQL, "SELECT a FROM t WHERE b = ? AND c > ?;", "SELECT a FROM t WHERE b = ? AND c > ?;"},
+		{"Nil", nil, "SELECT a FROM t WHERE b = ?;", "SELECT a FROM t WHERE b = ?;"},
+		{"SQLite", SQLite, "SELECT a FROM t WHERE b = ?;", "SELECT a FROM t WHERE b = ?;"},
+		{"Postgres", Postgres, "SELECT a FROM t WHERE b = ? AND c > ? LIMIT ?;", "SELECT a FROM t WHERE b = $1 AND c > $2 LIMIT $3;"},
+		{"No params", Postgres, "SELECT 1;", "SELECT 1;"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.dialect.rebind(tt.query), tt.want)
+		})
+	}
+}
+
+// Stand-ins for the errors of the SQLite & PostgreSQL drivers.
+type codeError int
+
+func (e codeError) Error() string { return fmt.Sprintf("code %d", int(e)) }
+func (e codeError) Code() int     { return int(e) }
+
+type sqlStateError string
+
+func (e sqlStateError) Error() string    { return "sqlstate " + string(e) }
+func (e sqlStateError) SQLState() string { return string(e) }
+
+func TestIsDuplicate(t *testing.T) {
+	tests := []struct {
+		name    string
+		dialect *Dialect
+		err     error
+		want    bool
+	}{
+		{"MySQL duplicate", MySQL, &mysql.MySQLError{Number: 1062}, true},
+		{"MySQL wrapped", MySQL, fmt.Errorf("insert: %w", &mysql.MySQLError{Number: 1062}), true},
+		{"MySQL other", MySQL, &mysql.MySQLError{Number: 1452}, false},
+		{"SQLite unique", SQLite, codeError(2067), true},
+		{"SQLite primary key", SQLite, codeError(1555), true},
+		{"SQLite other", SQLite, codeError(787), false},
+		{"Postgres unique", Postgres, sqlStateError("23505"), true},
+		{"Postgres other", Postgres, sqlStateError("23503"), false},
+		{"Plain error", Postgres, errors.New("boom"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.dialect.isDuplicate(tt.err), tt.want)
+		})
+	}
+}
@@ -10,4 +10,10 @@ var (
 
 	// If user tries to signup with an already registerred email.
 	ErrDuplicateEmail = errors.New("models: duplicate email")
+
+	// If a memo was changed by someone else (e.g., in another tab) since it was loaded for editing.
+	ErrEditConflict = errors.New("models: edit conflict")
+
+	// If a pagination cursor has been tampered with, or was made for another sort order.
+	ErrInvalidCursor = errors.New("models: invalid cursor")
 )
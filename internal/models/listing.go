@@ -0,0 +1,273 @@
+package models
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Orders in which memos can be listed.
+const (
+	SortNewest  = "newest"  // most recently created first
+	SortOldest  = "oldest"  // least recently created first
+	SortExpires = "expires" // soonest to expire first; memos which never expire come last
+	SortTitle   = "title"   // alphabetically by title
+)
+
+// All sort orders, e.g. for validating form input.
+var SortOrders = []string{SortNewest, SortOldest, SortExpires, SortTitle}
+
+// A `MemoFilter` selects a page of listed memos (see `MemoStore.List()`).
+// Zero values don't filter anything.
+type MemoFilter struct {
+	Author string // Name of the author.
+	Tag    string // Only memos with this tag.
+	// Only memos created in [CreatedFrom, CreatedUntil).
+	CreatedFrom, CreatedUntil time.Time
+	// Only memos expiring before this date (so never memos which never expire).
+	ExpiresBefore time.Time
+
+	Sort   string // One of `SortOrders`; defaults to `SortNewest`.
+	Cursor string // `Prev` or `Next` of the previous page; empty for the first page.
+	Limit  int    // Memos per page; defaults to `DefaultPageSize`.
+}
+
+// How many memos a page holds, unless the filter says otherwise.
+const DefaultPageSize = 10
+
+// A `MemoPage` is one page of a listing.
+// `Prev` & `Next` are the cursors of the pages before & after it; empty if there's no such page.
+type MemoPage struct {
+	Memos      []Memo
+	Prev, Next string
+}
+
+// A position in a listing: just after (or before) the memo with the given sort key & ID.
+// Sort keys are titles, or dates formatted as RFC 3339.
+// The memo itself needn't still exist, so pages stay stable while memos come & go.
+type cursor struct {
+	Sort   string `json:"s"`
+	Key    string `json:"k"`
+	ID     int    `json:"id"`
+	Before bool   `json:"b,omitempty"`
+}
+
+// Stands in for the expiry date of memos which never expire, so they're sorted last.
+var farFuture = time.Date(9999, 12, 31, 0, 0, 0, 0, time.UTC)
+
+// Fill in the defaults of the filter and decode its cursor (nil if it's empty).
+// Returns `ErrInvalidCursor` if the cursor is malformed or belongs to another sort order.
+func (f *MemoFilter) prepare() (*cursor, error) {
+	if f.Sort == "" {
+		f.Sort = SortNewest
+	}
+	if f.Limit <= 0 {
+		f.Limit = DefaultPageSize
+	}
+
+	if f.Cursor == "" {
+		return nil, nil
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(f.Cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var c cursor
+	err = json.Unmarshal(b, &c)
+	if err != nil || c.Sort != f.Sort {
+		return nil, ErrInvalidCursor
+	}
+	if f.Sort != SortTitle {
+		_, err = time.Parse(time.RFC3339Nano, c.Key)
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+	}
+
+	return &c, nil
+}
+
+// Whether the sort order is descending.
+func (f *MemoFilter) descending() bool {
+	return f.Sort == SortNewest
+}
+
+// The value of `memo` which the listing is sorted by.
+func (f *MemoFilter) sortKey(memo Memo) string {
+	switch f.Sort {
+	case SortTitle:
+		return memo.Title
+	case SortExpires:
+		if memo.Expires.IsZero() {
+			return farFuture.Format(time.RFC3339Nano)
+		}
+		return memo.Expires.UTC().Format(time.RFC3339Nano)
+	}
+	return memo.Created.UTC().Format(time.RFC3339Nano)
+}
+
+// The sort key of a cursor as a query argument.
+func (f *MemoFilter) keyArg(c *cursor) any {
+	if f.Sort == SortTitle {
+		return c.Key
+	}
+	t, _ := time.Parse(time.RFC3339Nano, c.Key)
+	return t.UTC()
+}
+
+// Encode the cursor pointing just after (or before) `memo`.
+func (f *MemoFilter) cursorAt(memo Memo, before bool) string {
+	b, _ := json.Marshal(cursor{Sort: f.Sort, Key: f.sortKey(memo), ID: memo.ID, Before: before})
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// Turn the memos fetched for a page into the page.
+// `memos` are in the order they were fetched: backwards if `c` points before a memo,
+// and they include one memo too many if there's another page in that direction.
+func (f *MemoFilter) page(memos []Memo, c *cursor) MemoPage {
+	backward := c != nil && c.Before
+
+	more := len(memos) > f.Limit
+	if more {
+		memos = memos[:f.Limit]
+	}
+	if backward {
+		for i, j := 0, len(memos)-1; i < j; i, j = i+1, j-1 {
+			memos[i], memos[j] = memos[j], memos[i]
+		}
+	}
+
+	page := MemoPage{Memos: memos}
+	if len(memos) == 0 {
+		return page
+	}
+
+	first, last := memos[0], memos[len(memos)-1]
+	if backward {
+		// Coming back from a later page, there's always a next page.
+		if more {
+			page.Prev = f.cursorAt(first, true)
+		}
+		page.Next = f.cursorAt(last, false)
+	} else {
+		// Coming from an earlier page, there's always a previous page.
+		if more {
+			page.Next = f.cursorAt(last, false)
+		}
+		if c != nil {
+			page.Prev = f.cursorAt(first, true)
+		}
+	}
+	return page
+}
+
+// Build the WHERE conditions & ORDER BY clause (with their arguments) listing memos by `f`, starting at `c`.
+// N.B. Like every listing, only public memos which are neither expired nor in the trash are included.
+func (f *MemoFilter) sql(c *cursor) (where, orderBy string, args []any) {
+	conds := []string{"(m.expires IS NULL OR m.expires > ?)", "m.deleted IS NULL", "m.visibility = 'public'"}
+	args = []any{now()}
+
+	add := func(cond string, condArgs ...any) {
+		conds = append(conds, cond)
+		args = append(args, condArgs...)
+	}
+
+	if f.Author != "" {
+		add("u.name = ?", f.Author)
+	}
+	if f.Tag != "" {
+		add(`EXISTS (SELECT 1 FROM memo_tags mt INNER JOIN tags t ON t.id = mt.tag_id
+		WHERE mt.memo_id = m.id AND t.name = ?)`, f.Tag)
+	}
+	if !f.CreatedFrom.IsZero() {
+		add("m.created >= ?", f.CreatedFrom.UTC())
+	}
+	if !f.CreatedUntil.IsZero() {
+		add("m.created < ?", f.CreatedUntil.UTC())
+	}
+	if !f.ExpiresBefore.IsZero() {
+		add("m.expires < ?", f.ExpiresBefore.UTC())
+	}
+
+	// The sort key; memos which never expire sort as if they expired in the far future.
+	column, columnArgs := "m.created", []any(nil)
+	switch f.Sort {
+	case SortTitle:
+		column = "m.title"
+	case SortExpires:
+		column, columnArgs = "COALESCE(m.expires, ?)", []any{farFuture}
+	}
+
+	// Ties are broken by ID, so every memo has a unique position.
+	// Pages before the cursor are fetched in reverse order.
+	desc := f.descending() != (c != nil && c.Before)
+	cmp, dir := ">", "ASC"
+	if desc {
+		cmp, dir = "<", "DESC"
+	}
+
+	if c != nil {
+		key := f.keyArg(c)
+		cond := "(" + column + " " + cmp + " ? OR (" + column + " = ? AND m.id " + cmp + " ?))"
+		condArgs := append([]any{}, columnArgs...)
+		condArgs = append(condArgs, key)
+		condArgs = append(condArgs, columnArgs...)
+		condArgs = append(condArgs, key, c.ID)
+		add(cond, condArgs...)
+	}
+
+	args = append(args, columnArgs...)
+	return strings.Join(conds, " AND "), column + " " + dir + ", m.id " + dir, args
+}
+
+// Whether `memo` matches the filter, for the in-memory backend (see `sql()` for the SQL equivalent).
+func (f *MemoFilter) match(memo Memo, t time.Time, c *cursor) bool {
+	if !memo.live(t) || !memo.Listed() {
+		return false
+	}
+	if f.Author != "" && memo.Author != f.Author {
+		return false
+	}
+	if f.Tag != "" && !slices.Contains(memo.Tags, f.Tag) {
+		return false
+	}
+	if !f.CreatedFrom.IsZero() && memo.Created.Before(f.CreatedFrom) {
+		return false
+	}
+	if !f.CreatedUntil.IsZero() && !memo.Created.Before(f.CreatedUntil) {
+		return false
+	}
+	if !f.ExpiresBefore.IsZero() && (memo.Expires.IsZero() || !memo.Expires.Before(f.ExpiresBefore)) {
+		return false
+	}
+
+	if c != nil {
+		if c.Before {
+			return f.less(memo.ID, f.sortKey(memo), c.ID, c.Key)
+		}
+		return f.less(c.ID, c.Key, memo.ID, f.sortKey(memo))
+	}
+	return true
+}
+
+// Whether the memo with ID `a` & sort key `aKey` comes before the one with ID `b` & `bKey` in the listing.
+func (f *MemoFilter) less(a int, aKey string, b int, bKey string) bool {
+	if f.descending() {
+		a, aKey, b, bKey = b, bKey, a, aKey
+	}
+
+	if f.Sort != SortTitle {
+		ta, _ := time.Parse(time.RFC3339Nano, aKey)
+		tb, _ := time.Parse(time.RFC3339Nano, bKey)
+		if !ta.Equal(tb) {
+			return ta.Before(tb)
+		}
+	} else if aKey != bKey {
+		return aKey < bKey
+	}
+	return a < b
+}
@@ -0,0 +1,577 @@
+package models
+
+import (
+	"errors"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/heschmat/MemoBin/internal/search"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// The in-memory backend keeps everything in maps guarded by a mutex.
+// It needs no database at all, which makes it handy for development & tests,
+// but everything is gone once the process exits.
+type memoryDB struct {
+	mu        sync.Mutex
+	users     map[int]User
+	memos     map[int]Memo
+	revisions map[int][]Revision // by memo ID
+	tokens    map[string]Token   // by hash
+	// There's no database to do full-text search, so memos are indexed in-process.
+	index *search.Index
+
+	lastUserID, lastMemoID, lastRevisionID, lastTokenID int
+}
+
+// `MemoryMemoStore` is the in-memory implementation of `MemoStore`.
+type MemoryMemoStore struct {
+	db *memoryDB
+}
+
+// `MemoryUserStore` is the in-memory implementation of `UserStore`.
+type MemoryUserStore struct {
+	db *memoryDB
+}
+
+// Create an empty in-memory backend.
+// The two stores share their data, as memos refer to their authors.
+func NewMemoryStores() (*MemoryMemoStore, *MemoryUserStore) {
+	db := &memoryDB{
+		users:     make(map[int]User),
+		memos:     make(map[int]Memo),
+		revisions: make(map[int][]Revision),
+		tokens:    make(map[string]Token),
+		index:     search.NewIndex(),
+	}
+	return &MemoryMemoStore{db: db}, &MemoryUserStore{db: db}
+}
+
+// Whether a memo is returned by lookups & listings: neither expired nor in the trash.
+func (memo Memo) live(now time.Time) bool {
+	return (memo.Expires.IsZero() || memo.Expires.After(now)) && memo.Deleted.IsZero()
+}
+
+// Fill in the author's name, like the SQL queries do by joining *users*.
+// N.B. The caller must hold the lock.
+func (db *memoryDB) withAuthor(memo Memo) Memo {
+	memo.Author = db.users[memo.UserID].Name
+	// Callers mustn't be able to change the stored memo.
+	memo.Tags = slices.Clone(memo.Tags)
+	return memo
+}
+
+// Return the memos matching `keep`, sorted by `less`.
+// N.B. The caller must hold the lock.
+func (db *memoryDB) filter(keep func(Memo) bool, less func(a, b Memo) bool) []Memo {
+	var memos []Memo
+	for _, memo := range db.memos {
+		if keep(memo) {
+			memos = append(memos, db.withAuthor(memo))
+		}
+	}
+
+	sort.Slice(memos, func(i, j int) bool { return less(memos[i], memos[j]) })
+	return memos
+}
+
+// Remove a memo along with its revisions (like ON DELETE CASCADE).
+// N.B. The caller must hold the lock.
+func (db *memoryDB) remove(id int) {
+	delete(db.memos, id)
+	delete(db.revisions, id)
+	db.index.Remove(id)
+}
+
+// Remove up to `limit` memos matching `match`, oldest first.
+func (db *memoryDB) removeBatch(limit int, match func(Memo) bool) int64 {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	memos := db.filter(match, func(a, b Memo) bool { return a.ID < b.ID })
+	if len(memos) > limit {
+		memos = memos[:limit]
+	}
+
+	for _, memo := range memos {
+		db.remove(memo.ID)
+	}
+	return int64(len(memos))
+}
+
+func (s *MemoryMemoStore) Get(id int) (Memo, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	memo, ok := s.db.memos[id]
+	if !ok || !memo.live(now()) {
+		return Memo{}, ErrNoRecord
+	}
+	return s.db.withAuthor(memo), nil
+}
+
+func (s *MemoryMemoStore) GetBySlug(slug string) (Memo, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	t := now()
+	for _, memo := range s.db.memos {
+		if memo.Slug == slug && memo.live(t) {
+			return s.db.withAuthor(memo), nil
+		}
+	}
+	return Memo{}, ErrNoRecord
+}
+
+// Memos in this store have always had slugs, so none has a legacy ID.
+func (s *MemoryMemoStore) GetByLegacyID(id int) (Memo, error) {
+	return Memo{}, ErrNoRecord
+}
+
+func (s *MemoryMemoStore) List(filter MemoFilter) (MemoPage, error) {
+	c, err := filter.prepare()
+	if err != nil {
+		return MemoPage{}, err
+	}
+
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	// Like `MemoModel.List()`, fetch one memo more than needed, backwards for pages before the cursor.
+	t := now()
+	backward := c != nil && c.Before
+	memos := s.db.filter(func(memo Memo) bool {
+		return filter.match(s.db.withAuthor(memo), t, c)
+	}, func(a, b Memo) bool {
+		return filter.less(a.ID, filter.sortKey(a), b.ID, filter.sortKey(b)) != backward
+	})
+
+	if len(memos) > filter.Limit+1 {
+		memos = memos[:filter.Limit+1]
+	}
+	return filter.page(memos, c), nil
+}
+
+func (s *MemoryMemoStore) Search(query string, userID, limit int) ([]Memo, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	var memos []Memo
+	t := now()
+	for _, hit := range s.db.index.Search(search.Terms(query)) {
+		memo := s.db.memos[hit.ID]
+		searchable := memo.Listed() && !memo.HasPassword() && !memo.BurnAfterReading
+		if !memo.live(t) || !(searchable || memo.OwnedBy(userID)) {
+			continue
+		}
+
+		memos = append(memos, s.db.withAuthor(memo))
+		if len(memos) == limit {
+			break
+		}
+	}
+	return memos, nil
+}
+
+func (s *MemoryMemoStore) Tags(prefix string, userID, limit int) ([]string, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	prefix = strings.ToLower(prefix)
+	counts := make(map[string]int)
+	t := now()
+	for _, memo := range s.db.memos {
+		if !memo.live(t) || !(memo.Listed() || memo.OwnedBy(userID)) {
+			continue
+		}
+		for _, tag := range memo.Tags {
+			if strings.HasPrefix(tag, prefix) {
+				counts[tag]++
+			}
+		}
+	}
+
+	var tags []string
+	for tag := range counts {
+		tags = append(tags, tag)
+	}
+	// Most used first, like the SQL backends.
+	sort.Slice(tags, func(i, j int) bool {
+		if counts[tags[i]] == counts[tags[j]] {
+			return tags[i] < tags[j]
+		}
+		return counts[tags[i]] > counts[tags[j]]
+	})
+
+	if len(tags) > limit {
+		tags = tags[:limit]
+	}
+	return tags, nil
+}
+
+func (s *MemoryMemoStore) Insert(userID int, title, content string, expires time.Time, opts MemoOptions) (string, error) {
+	if opts.Visibility == "" {
+		opts.Visibility = VisibilityPublic
+	}
+	if opts.Format == "" {
+		opts.Format = FormatPlain
+	}
+
+	var hashedPassword []byte
+	if opts.Password != "" {
+		var err error
+		hashedPassword, err = bcrypt.GenerateFromPassword([]byte(opts.Password), 12)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	// Like the unique constraint on `slug`, just without the round trips.
+	var slug string
+	for taken := true; taken; {
+		var err error
+		slug, err = newSlug()
+		if err != nil {
+			return "", err
+		}
+
+		taken = false
+		for _, memo := range s.db.memos {
+			taken = taken || memo.Slug == slug
+		}
+	}
+
+	s.db.lastMemoID++
+	created := now()
+	s.db.memos[s.db.lastMemoID] = Memo{
+		ID:               s.db.lastMemoID,
+		Slug:             slug,
+		UserID:           userID,
+		Title:            title,
+		Content:          content,
+		Created:          created,
+		Expires:          expiresAt(expires),
+		Updated:          created,
+		Version:          1,
+		BurnAfterReading: opts.BurnAfterReading,
+		HashedPassword:   hashedPassword,
+		Visibility:       opts.Visibility,
+		Tags:             sortedTags(opts.Tags),
+		Language:         opts.Language,
+		Format:           opts.Format,
+	}
+	s.db.index.Add(s.db.lastMemoID, title, content)
+
+	return slug, nil
+}
+
+func (s *MemoryMemoStore) Update(id, userID int, title, content string, expires time.Time, version int, opts MemoOptions) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	memo, ok := s.db.memos[id]
+	if !ok || !memo.live(now()) || memo.UserID != userID {
+		return ErrNoRecord
+	}
+	if memo.Version != version {
+		return ErrEditConflict
+	}
+
+	s.db.lastRevisionID++
+	revision := currentRevision(memo)
+	revision.ID = s.db.lastRevisionID
+	revision.Author = ""
+	s.db.revisions[id] = append(s.db.revisions[id], revision)
+
+	memo.Title = title
+	memo.Content = content
+	memo.Expires = expiresAt(expires)
+	if opts.Visibility != "" {
+		memo.Visibility = opts.Visibility
+	}
+	if opts.Language != "" {
+		memo.Language = opts.Language
+	}
+	if opts.Format != "" {
+		memo.Format = opts.Format
+	}
+	if opts.Tags != nil {
+		memo.Tags = sortedTags(opts.Tags)
+	}
+	memo.Updated = now()
+	memo.Version++
+	s.db.memos[id] = memo
+	s.db.index.Add(id, title, content)
+
+	return nil
+}
+
+func (s *MemoryMemoStore) Burn(id int) (Memo, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	memo, ok := s.db.memos[id]
+	if !ok || !memo.live(now()) || !memo.BurnAfterReading {
+		return Memo{}, ErrNoRecord
+	}
+
+	memo = s.db.withAuthor(memo)
+	s.db.remove(id)
+	return memo, nil
+}
+
+func (s *MemoryMemoStore) Revisions(memo Memo) ([]Revision, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	revisions := []Revision{currentRevision(memo)}
+
+	stored := s.db.revisions[memo.ID]
+	for i := len(stored) - 1; i >= 0; i-- {
+		r := stored[i]
+		r.Author = s.db.users[r.UserID].Name
+		revisions = append(revisions, r)
+	}
+
+	return revisions, nil
+}
+
+func (s *MemoryMemoStore) Revision(memo Memo, version int) (Revision, error) {
+	if version == memo.Version {
+		return currentRevision(memo), nil
+	}
+
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	for _, r := range s.db.revisions[memo.ID] {
+		if r.Version == version {
+			r.Author = s.db.users[r.UserID].Name
+			return r, nil
+		}
+	}
+	return Revision{}, ErrNoRecord
+}
+
+func (s *MemoryMemoStore) Delete(id, userID int) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	memo, ok := s.db.memos[id]
+	if !ok || memo.UserID != userID || !memo.Deleted.IsZero() {
+		return ErrNoRecord
+	}
+
+	memo.Deleted = now()
+	s.db.memos[id] = memo
+	return nil
+}
+
+func (s *MemoryMemoStore) Trash(userID int) ([]Memo, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	t := now()
+	return s.db.filter(func(memo Memo) bool {
+		return memo.UserID == userID && (memo.Expires.IsZero() || memo.Expires.After(t)) &&
+			memo.Deleted.After(t.Add(-TrashRetention))
+	}, func(a, b Memo) bool {
+		if a.Deleted.Equal(b.Deleted) {
+			return a.ID > b.ID
+		}
+		return a.Deleted.After(b.Deleted)
+	}), nil
+}
+
+func (s *MemoryMemoStore) Restore(id, userID int) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	memo, ok := s.db.memos[id]
+	if !ok || memo.UserID != userID || !memo.Deleted.After(now().Add(-TrashRetention)) {
+		return ErrNoRecord
+	}
+
+	memo.Deleted = time.Time{}
+	s.db.memos[id] = memo
+	return nil
+}
+
+func (s *MemoryMemoStore) Purge(id, userID int) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	memo, ok := s.db.memos[id]
+	if !ok || memo.UserID != userID || memo.Deleted.IsZero() {
+		return ErrNoRecord
+	}
+
+	s.db.remove(id)
+	return nil
+}
+
+func (s *MemoryMemoStore) DeleteExpired(limit int) (int64, error) {
+	t := now()
+	return s.db.removeBatch(limit, func(memo Memo) bool {
+		return !memo.Expires.IsZero() && !memo.Expires.After(t)
+	}), nil
+}
+
+func (s *MemoryMemoStore) PurgeTrash(limit int) (int64, error) {
+	cutoff := now().Add(-TrashRetention)
+	return s.db.removeBatch(limit, func(memo Memo) bool {
+		return !memo.Deleted.IsZero() && !memo.Deleted.After(cutoff)
+	}), nil
+}
+
+// Store expiry dates the way they come back from the database: UTC, or zero for never.
+func expiresAt(t time.Time) time.Time {
+	if t.IsZero() {
+		return t
+	}
+	return t.UTC()
+}
+
+func (s *MemoryUserStore) Insert(name, email, password string) error {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), 12)
+	if err != nil {
+		return err
+	}
+
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	for _, user := range s.db.users {
+		if user.Email == email {
+			return ErrDuplicateEmail
+		}
+	}
+
+	s.db.lastUserID++
+	s.db.users[s.db.lastUserID] = User{
+		ID:             s.db.lastUserID,
+		Name:           name,
+		Email:          email,
+		HashedPassword: hashedPassword,
+		Created:        now(),
+	}
+
+	return nil
+}
+
+func (s *MemoryUserStore) Authenticate(email, password string) (int, error) {
+	s.db.mu.Lock()
+	var user User
+	for _, u := range s.db.users {
+		if u.Email == email {
+			user = u
+		}
+	}
+	s.db.mu.Unlock()
+
+	if user.ID == 0 {
+		return 0, ErrInvalidCredentials
+	}
+
+	err := bcrypt.CompareHashAndPassword(user.HashedPassword, []byte(password))
+	if err != nil {
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return 0, ErrInvalidCredentials
+		}
+		return 0, err
+	}
+
+	return user.ID, nil
+}
+
+func (s *MemoryUserStore) Exists(id int) (bool, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	_, ok := s.db.users[id]
+	return ok, nil
+}
+
+func (s *MemoryUserStore) Get(id int) (User, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	user, ok := s.db.users[id]
+	if !ok {
+		return User{}, ErrNoRecord
+	}
+	user.HashedPassword = nil
+	return user, nil
+}
+
+func (s *MemoryUserStore) NewToken(userID int, name, scope string) (string, error) {
+	token, hash, err := generateToken()
+	if err != nil {
+		return "", err
+	}
+
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	s.db.lastTokenID++
+	s.db.tokens[hash] = Token{
+		ID:      s.db.lastTokenID,
+		UserID:  userID,
+		Name:    name,
+		Scope:   scope,
+		Created: now(),
+	}
+
+	return token, nil
+}
+
+func (s *MemoryUserStore) AuthenticateToken(token string) (Token, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	hash := hashToken(token)
+	t, ok := s.db.tokens[hash]
+	if !ok {
+		return Token{}, ErrInvalidCredentials
+	}
+
+	if used := now(); used.Sub(t.LastUsed) >= tokenUseResolution {
+		t.LastUsed = used
+		s.db.tokens[hash] = t
+	}
+	return t, nil
+}
+
+func (s *MemoryUserStore) Tokens(userID int) ([]Token, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	var tokens []Token
+	for _, t := range s.db.tokens {
+		if t.UserID == userID {
+			tokens = append(tokens, t)
+		}
+	}
+	// Newest first, like the SQL query.
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].ID > tokens[j].ID })
+	return tokens, nil
+}
+
+func (s *MemoryUserStore) RevokeToken(id, userID int) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	for hash, t := range s.db.tokens {
+		if t.ID == id && t.UserID == userID {
+			delete(s.db.tokens, hash)
+			return nil
+		}
+	}
+	return ErrNoRecord
+}
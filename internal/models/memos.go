@@ -3,56 +3,169 @@ package models
 import (
 	"database/sql"
 	"errors"
+	"strings"
 	"time"
+
+	"github.com/heschmat/MemoBin/internal/search"
+	"golang.org/x/crypto/bcrypt"
 )
 
 // Define a `Memo` type to hold the data or an individual "memo".
 type Memo struct {
 	ID      int
+	Slug    string // Random, URL-safe identifier used in URLs instead of the (guessable) ID.
+	UserID  int    // ID of the user who created the memo.
+	Author  string // Name of the user who created the memo (joined from *users*).
 	Title   string
 	Content string
 	Created time.Time
-	Expires time.Time
+	Expires time.Time // The zero value means the memo never expires.
+	Updated time.Time // When the memo was last edited (equal to `Created` for new memos).
+	Version int       // Incremented on every edit; used for optimistic concurrency control.
+	Deleted time.Time // When the memo was moved to the trash (zero if it isn't in the trash).
+
+	// The memo is deleted as soon as someone other than its author has read it.
+	BurnAfterReading bool
+	// bcrypt hash of the password needed to read the memo (nil if it isn't password-protected).
+	HashedPassword []byte
+	// Who can find & read the memo; one of the `Visibility...` constants.
+	Visibility string
+	// Sorted by name; nil if the memo has no tags.
+	Tags []string
+	// The language the content is highlighted as (an ID of `highlight.Languages`); empty for plain text.
+	Language string
+	// How the content is rendered; one of the `Format...` constants.
+	Format string
+}
+
+// Visibility levels of a memo.
+const (
+	VisibilityPublic   = "public"   // listed on the home page (and in every other listing)
+	VisibilityUnlisted = "unlisted" // readable by anyone with the link, but never listed
+	VisibilityPrivate  = "private"  // only readable by its owner
+)
+
+// All visibility levels, e.g. for validating form input.
+var Visibilities = []string{VisibilityPublic, VisibilityUnlisted, VisibilityPrivate}
+
+// Formats of the content of a memo.
+const (
+	FormatPlain    = "plain"    // shown as it is, highlighted in the memo's language
+	FormatMarkdown = "markdown" // rendered to (sanitized) HTML
+)
+
+// All formats, e.g. for validating form input.
+var Formats = []string{FormatPlain, FormatMarkdown}
+
+// Settings which can be chosen when creating a memo, besides its title, content & expiry.
+type MemoOptions struct {
+	BurnAfterReading bool
+	Password         string // Plain-text access password; empty for none.
+	Visibility       string // Defaults to `VisibilityPublic`.
+	Tags             []string
+	Language         string // Empty for plain text.
+	Format           string // Defaults to `FormatPlain`.
+}
+
+// Report whether the user with the given ID (0 for anonymous users) may see the memo at all.
+// N.B. Any code returning memos to users must check this (or filter on `visibility` in SQL).
+func (m Memo) VisibleTo(userID int) bool {
+	if m.Visibility == VisibilityPrivate {
+		return m.OwnedBy(userID)
+	}
+	return true
+}
+
+// Whether the memo shows up in listings such as the home page.
+func (m Memo) Listed() bool {
+	return m.Visibility == VisibilityPublic
+}
+
+// Whether a password is needed to read the memo.
+func (m Memo) HasPassword() bool {
+	return len(m.HashedPassword) > 0
+}
+
+// Check `password` against the memo's access password.
+// Returns `ErrInvalidCredentials` if it doesn't match.
+func (m Memo) CheckPassword(password string) error {
+	err := bcrypt.CompareHashAndPassword(m.HashedPassword, []byte(password))
+	if err != nil {
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return ErrInvalidCredentials
+		}
+		return err
+	}
+	return nil
+}
+
+// How long deleted memos stay in the trash before they're purged for good.
+const TrashRetention = 30 * 24 * time.Hour
+
+// Convert an expiry date to a query argument: NULL if the memo never expires.
+func nullTime(t time.Time) any {
+	if t.IsZero() {
+		return nil
+	}
+	return t.UTC()
+}
+
+// The date after which a memo in the trash can no longer be restored.
+func (m Memo) PurgeAfter() time.Time {
+	if m.Deleted.IsZero() {
+		return time.Time{}
+	}
+	return m.Deleted.Add(TrashRetention)
+}
+
+// OwnedBy reports whether the memo was created by the given user.
+// Every mutation of an existing memo must be guarded by this check.
+func (m Memo) OwnedBy(userID int) bool {
+	return userID > 0 && m.UserID == userID
 }
 
 // `MemoModel` wraps a sql.DB connection pool.
+// It's the SQL implementation of `MemoStore`, used for MySQL, PostgreSQL and SQLite.
 type MemoModel struct {
 	DB      *sql.DB
+	Dialect *Dialect // The database's flavour of SQL; nil means MySQL.
 }
 
-// GET memo/{id}
-func (m *MemoModel) Get(id int) (Memo, error) {
-	query := `SELECT id, title, content, created, expires FROM memos
-	WHERE expires > UTC_TIMESTAMP() AND id = ?;`
-
-	// Returns a pointer to a `sql.Row` object, which holds the result.
-	row := m.DB.QueryRow(query, id)
+// The columns selected by every query returning memos, in the order expected by `scanMemo()`.
+// N.B. Queries must alias *memos* as `m` and join *users* as `u`.
+const memoColumns = `m.id, m.slug, m.user_id, u.name, m.title, m.content, m.created, m.expires,
+	m.updated, m.version, m.deleted, m.burn_after_reading, m.hashed_password, m.visibility, m.language, m.format`
 
-	var memo Memo // Initialize a new zeroed Memo struct.
+// Scan a row selected with `memoColumns` into a Memo struct.
+// Works with both *sql.Row and *sql.Rows.
+func scanMemo(row interface{ Scan(...any) error }) (Memo, error) {
+	var memo Memo
+	var expires, deleted sql.NullTime
 
-	err := row.Scan(&memo.ID, &memo.Title, &memo.Content, &memo.Created, &memo.Expires)
+	err := row.Scan(&memo.ID, &memo.Slug, &memo.UserID, &memo.Author, &memo.Title, &memo.Content, &memo.Created, &expires,
+		&memo.Updated, &memo.Version, &deleted, &memo.BurnAfterReading, &memo.HashedPassword, &memo.Visibility,
+		&memo.Language, &memo.Format)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return Memo{}, ErrNoRecord // We define `ErrNoRecord`
-		}
 		return Memo{}, err
 	}
 
-	// If everythig went OK, return the filled Memo struct.
+	// `expires` is NULL for memos which never expire,
+	// `deleted` is NULL unless the memo is in the trash.
+	memo.Expires = expires.Time
+	memo.Deleted = deleted.Time
+
 	return memo, nil
 }
 
-func (m *MemoModel) Latest() ([]Memo, error) {
-	query := `SELECT id, title, content, created, expires FROM memos
-	WHERE expires > UTC_TIMESTAMP() ORDER BY id DESC LIMIT 10;`
-
-	rows, err := m.DB.Query(query)
+// Run a query selecting `memoColumns` and collect the resulting memos.
+func (m *MemoModel) queryMemos(query string, args ...any) ([]Memo, error) {
+	rows, err := m.DB.Query(m.Dialect.rebind(query), args...)
 	if err != nil {
 		return nil, err
 	}
 
 	// *defer* rows.Close() to ensure the sql.Rows resultset is always properly closed
-	// before Latest() method returns.
+	// before the method returns.
 	// N.B. This should come **after** checking for an error from the Query() method.
 	// Or you may get a **panic**.
 	defer rows.Close()
@@ -61,13 +174,12 @@ func (m *MemoModel) Latest() ([]Memo, error) {
 	var memos []Memo
 
 	for rows.Next() {
-		var m Memo
-		err = rows.Scan(&m.ID, &m.Title, &m.Content, &m.Created, &m.Expires)
+		memo, err := scanMemo(rows)
 		if err != nil {
 			return nil, err
 		}
 
-		memos = append(memos, m)
+		memos = append(memos, memo)
 	}
 
 	// Retrieve any error that was encountered dureing the iteration.
@@ -75,29 +187,398 @@ func (m *MemoModel) Latest() ([]Memo, error) {
 		return nil, err
 	}
 
+	// Release the connection first: SQLite only has the one.
+	rows.Close()
+	err = m.loadTags(m.DB, memos)
+	if err != nil {
+		return nil, err
+	}
+
 	// If everything went OK, return the Memos slice.
 	return memos, nil
 }
 
+// GET memo/{id}
+func (m *MemoModel) Get(id int) (Memo, error) {
+	query := `SELECT ` + memoColumns + `
+	FROM memos m INNER JOIN users u ON u.id = m.user_id
+	WHERE (m.expires IS NULL OR m.expires > ?) AND m.deleted IS NULL AND m.id = ?;`
+
+	// Returns a pointer to a `sql.Row` object, which holds the result.
+	row := m.DB.QueryRow(m.Dialect.rebind(query), now(), id)
+
+	memo, err := scanMemo(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Memo{}, ErrNoRecord // We define `ErrNoRecord`
+		}
+		return Memo{}, err
+	}
+
+	// If everythig went OK, return the filled Memo struct (with its tags).
+	return m.withTags(memo)
+}
+
+// GET memo/view/{slug}
+func (m *MemoModel) GetBySlug(slug string) (Memo, error) {
+	query := `SELECT ` + memoColumns + `
+	FROM memos m INNER JOIN users u ON u.id = m.user_id
+	WHERE (m.expires IS NULL OR m.expires > ?) AND m.deleted IS NULL AND m.slug = ?;`
+
+	memo, err := scanMemo(m.DB.QueryRow(m.Dialect.rebind(query), now(), slug))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Memo{}, ErrNoRecord
+		}
+		return Memo{}, err
+	}
+
+	return m.withTags(memo)
+}
+
+// Look up a memo by the numeric ID it was reachable under before memos had slugs.
+// Memos created since don't have a legacy ID, so their (sequential) IDs can't be used to find them.
+func (m *MemoModel) GetByLegacyID(id int) (Memo, error) {
+	query := `SELECT ` + memoColumns + `
+	FROM memos m INNER JOIN users u ON u.id = m.user_id
+	WHERE (m.expires IS NULL OR m.expires > ?) AND m.deleted IS NULL AND m.legacy_id = ?;`
+
+	memo, err := scanMemo(m.DB.QueryRow(m.Dialect.rebind(query), now(), id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Memo{}, ErrNoRecord
+		}
+		return Memo{}, err
+	}
+
+	return m.withTags(memo)
+}
+
+// Return a page of the listed memos matching `filter`.
+// Returns `ErrInvalidCursor` if the filter's cursor isn't one returned for the same sort order.
+func (m *MemoModel) List(filter MemoFilter) (MemoPage, error) {
+	c, err := filter.prepare()
+	if err != nil {
+		return MemoPage{}, err
+	}
+
+	where, orderBy, args := filter.sql(c)
+	query := `SELECT ` + memoColumns + `
+	FROM memos m INNER JOIN users u ON u.id = m.user_id
+	WHERE ` + where + `
+	ORDER BY ` + orderBy + ` LIMIT ?;`
+
+	// One more than needed, to find out whether there's another page.
+	memos, err := m.queryMemos(query, append(args, filter.Limit+1)...)
+	if err != nil {
+		return MemoPage{}, err
+	}
+
+	return filter.page(memos, c), nil
+}
+
+// Search the title & content of the memos `userID` (0 for anonymous users) may find,
+// and return up to `limit` of those containing every word of `query`, best match first.
+// Only listed memos which can be read straight away are searched (a snippet would reveal
+// the content of password-protected & burn-after-reading memos), plus the user's own memos.
+func (m *MemoModel) Search(query string, userID, limit int) ([]Memo, error) {
+	terms := search.Terms(query)
+	if len(terms) == 0 {
+		return nil, nil
+	}
+
+	d := m.Dialect.orDefault()
+	stmt := `SELECT ` + memoColumns + `
+	FROM memos m INNER JOIN users u ON u.id = m.user_id` + d.searchJoin + `
+	WHERE ` + d.searchMatch + ` AND (m.expires IS NULL OR m.expires > ?) AND m.deleted IS NULL
+	AND ((m.visibility = 'public' AND m.hashed_password IS NULL AND NOT m.burn_after_reading) OR m.user_id = ?)
+	ORDER BY ` + d.searchRank + `, m.id DESC LIMIT ?;`
+
+	expr := d.searchExpr(terms)
+	args := []any{expr, now(), userID}
+	if strings.Contains(d.searchRank, "?") {
+		args = []any{expr, now(), userID, expr}
+	}
+
+	return m.queryMemos(stmt, append(args, limit)...)
+}
+
 // POST
-func (m *MemoModel) Insert(title string, content string, expires int) (int, error) {
+// `userID` is the ID of the authenticated user creating the memo; it becomes the memo's owner.
+// `expires` is when the memo expires; the zero value means never.
+// Returns the slug of the new memo.
+func (m *MemoModel) Insert(userID int, title string, content string, expires time.Time, opts MemoOptions) (string, error) {
 	// Using `` we can split the query we want to execute over multiple lines for readability.
-	// N.B. PostgreSQL uses $N notation for placeholder parameter.
-	query := `INSERT INTO memos (title, content, created, expires)
-	VALUES(?, ?, UTC_TIMESTAMP(), DATE_ADD(UTC_TIMESTAMP(), INTERVAL ? DAY));`
+	// N.B. PostgreSQL uses $N notation for placeholder parameter; `rebind()` takes care of that.
+	query := `INSERT INTO memos (slug, user_id, title, content, created, expires, updated, version,
+	burn_after_reading, hashed_password, visibility, language, format)
+	VALUES(?, ?, ?, ?, ?, ?, ?, 1, ?, ?, ?, ?, ?);`
+
+	if opts.Visibility == "" {
+		opts.Visibility = VisibilityPublic
+	}
+	if opts.Format == "" {
+		opts.Format = FormatPlain
+	}
+
+	// Hash the access password the same way as user passwords; NULL means no password.
+	var hashedPassword any
+	if opts.Password != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(opts.Password), 12)
+		if err != nil {
+			return "", err
+		}
+		hashedPassword = string(hash)
+	}
+
+	// Slugs are random, so two memos could (very rarely) get the same one.
+	// In that case, the unique constraint rejects the insert and we try again with a new slug.
+	for attempt := 1; ; attempt++ {
+		slug, err := newSlug()
+		if err != nil {
+			return "", err
+		}
+
+		created := now()
+		err = m.insert(query, slug, opts.Tags, slug, userID, title, content, created, nullTime(expires), created,
+			opts.BurnAfterReading, hashedPassword, opts.Visibility, opts.Language, opts.Format)
+		if err != nil {
+			// N.B. `slug` is the only unique column set here (`legacy_id` is NULL for new memos).
+			if m.Dialect.orDefault().isDuplicate(err) && attempt < maxSlugAttempts {
+				continue
+			}
+			return "", err
+		}
+
+		return slug, nil
+	}
+}
+
+// Insert a memo with the given slug and tag it, in a transaction.
+func (m *MemoModel) insert(query, slug string, tags []string, args ...any) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
 
 	// `Exec()` returns a sql.Result type
 	// This contains basic information about what happened when the query executed.
-	result, err := m.DB.Exec(query, title, content, expires)
+	_, err = tx.Exec(m.Dialect.rebind(query), args...)
 	if err != nil {
-		return 0, err
+		return err
+	}
+
+	// N.B. Not every driver supports `LastInsertId()` (pgx doesn't).
+	var id int
+	err = tx.QueryRow(m.Dialect.rebind(`SELECT id FROM memos WHERE slug = ?;`), slug).Scan(&id)
+	if err != nil {
+		return err
+	}
+
+	err = m.setTags(tx, id, tags)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Update an existing memo owned by `userID`.
+// `version` must be the version of the memo the user started editing from;
+// if the memo has been changed since, nothing is written and `ErrEditConflict` is returned.
+// `expires` replaces the current expiry date; the zero value means never.
+// Of `opts`, only the settings which can be changed after creation are applied: `Visibility`,
+// `Language` & `Format` (an empty value keeps the current one) and `Tags` (nil keeps the current ones).
+// The version being replaced is kept in the *memo_revisions* table.
+func (m *MemoModel) Update(id, userID int, title, content string, expires time.Time, version int, opts MemoOptions) error {
+	// Saving the old version & updating the memo must happen together (or not at all).
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	// Rollback is a no-op once the transaction has been committed.
+	defer tx.Rollback()
+
+	// Lock the row, so nobody else can edit the memo until we're done.
+	query := `SELECT user_id, version FROM memos
+	WHERE id = ? AND (expires IS NULL OR expires > ?) AND deleted IS NULL` + m.Dialect.orDefault().lockRows + `;`
+
+	var ownerID, currentVersion int
+	err = tx.QueryRow(m.Dialect.rebind(query), id, now()).Scan(&ownerID, &currentVersion)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNoRecord
+		}
+		return err
+	}
+
+	// Only the owner may edit the memo.
+	if ownerID != userID {
+		return ErrNoRecord
+	}
+
+	// Someone else got there first.
+	if currentVersion != version {
+		return ErrEditConflict
+	}
+
+	query = `INSERT INTO memo_revisions (memo_id, version, user_id, title, content, created)
+	SELECT id, version, user_id, title, content, updated FROM memos WHERE id = ?;`
+
+	_, err = tx.Exec(m.Dialect.rebind(query), id)
+	if err != nil {
+		return err
+	}
+
+	query = `UPDATE memos SET title = ?, content = ?, expires = ?,
+	visibility = CASE WHEN ? = '' THEN visibility ELSE ? END,
+	language = CASE WHEN ? = '' THEN language ELSE ? END,
+	format = CASE WHEN ? = '' THEN format ELSE ? END,
+	updated = ?, version = version + 1
+	WHERE id = ?;`
+
+	_, err = tx.Exec(m.Dialect.rebind(query), title, content, nullTime(expires), opts.Visibility, opts.Visibility,
+		opts.Language, opts.Language, opts.Format, opts.Format, now(), id)
+	if err != nil {
+		return err
+	}
+
+	if opts.Tags != nil {
+		err = m.setTags(tx, id, opts.Tags)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Read a burn-after-reading memo and delete it in one go.
+// Of several concurrent readers only one gets the memo; everybody else gets `ErrNoRecord`.
+func (m *MemoModel) Burn(id int) (Memo, error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return Memo{}, err
+	}
+	defer tx.Rollback()
+
+	// Lock the row: concurrent readers wait here, then find it gone.
+	query := `SELECT ` + memoColumns + `
+	FROM memos m INNER JOIN users u ON u.id = m.user_id
+	WHERE (m.expires IS NULL OR m.expires > ?) AND m.deleted IS NULL AND m.burn_after_reading AND m.id = ?` +
+		m.Dialect.orDefault().lockRows + `;`
+
+	memo, err := scanMemo(tx.QueryRow(m.Dialect.rebind(query), now(), id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Memo{}, ErrNoRecord
+		}
+		return Memo{}, err
+	}
+
+	// Read the tags before they're gone.
+	memos := []Memo{memo}
+	err = m.loadTags(tx, memos)
+	if err != nil {
+		return Memo{}, err
+	}
+	memo = memos[0]
+
+	// Its revisions & tags go along with it (ON DELETE CASCADE).
+	_, err = tx.Exec(m.Dialect.rebind(`DELETE FROM memos WHERE id = ?;`), id)
+	if err != nil {
+		return Memo{}, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return Memo{}, err
+	}
+
+	return memo, nil
+}
+
+// Move a memo owned by `userID` to the trash.
+// It stays there for `TrashRetention`, hidden from every other query, until it's restored or purged.
+func (m *MemoModel) Delete(id, userID int) error {
+	query := `UPDATE memos SET deleted = ?
+	WHERE id = ? AND user_id = ? AND deleted IS NULL;`
+
+	return m.execOne(query, now(), id, userID)
+}
+
+// Return the memos in the trash of `userID`, most recently deleted first.
+func (m *MemoModel) Trash(userID int) ([]Memo, error) {
+	query := `SELECT ` + memoColumns + `
+	FROM memos m INNER JOIN users u ON u.id = m.user_id
+	WHERE m.user_id = ? AND (m.expires IS NULL OR m.expires > ?) AND m.deleted > ?
+	ORDER BY m.deleted DESC;`
+
+	t := now()
+	return m.queryMemos(query, userID, t, t.Add(-TrashRetention))
+}
+
+// Take a memo owned by `userID` out of the trash.
+func (m *MemoModel) Restore(id, userID int) error {
+	query := `UPDATE memos SET deleted = NULL
+	WHERE id = ? AND user_id = ? AND deleted > ?;`
+
+	return m.execOne(query, id, userID, now().Add(-TrashRetention))
+}
+
+// Permanently remove a memo owned by `userID` from the trash (along with its revisions).
+func (m *MemoModel) Purge(id, userID int) error {
+	query := `DELETE FROM memos WHERE id = ? AND user_id = ? AND deleted IS NOT NULL;`
+
+	return m.execOne(query, id, userID)
+}
+
+// Execute a statement which is expected to change exactly one memo.
+// If no row was changed, `ErrNoRecord` is returned.
+func (m *MemoModel) execOne(query string, args ...any) error {
+	result, err := m.DB.Exec(m.Dialect.rebind(query), args...)
+	if err != nil {
+		return err
 	}
 
-	// Get the ID of newly inserted record in the *memos* table.
-	id, err := result.LastInsertId()
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+// Permanently delete up to `limit` memos which have expired.
+// Returns the number of memos deleted; call it again until that's less than `limit` to clear a backlog.
+func (m *MemoModel) DeleteExpired(limit int) (int64, error) {
+	// N.B. `expires` is NULL for memos which never expire, so they never match.
+	// `DELETE ... LIMIT` is MySQL-only, hence the subquery (wrapped once more, as MySQL
+	// doesn't allow LIMIT directly inside IN).
+	query := `DELETE FROM memos WHERE id IN
+	(SELECT id FROM (SELECT id FROM memos WHERE expires <= ? LIMIT ?) AS batch);`
+
+	return m.execCount(query, now(), limit)
+}
+
+// Permanently delete up to `limit` memos which have been in the trash for longer than `TrashRetention`.
+func (m *MemoModel) PurgeTrash(limit int) (int64, error) {
+	query := `DELETE FROM memos WHERE id IN
+	(SELECT id FROM (SELECT id FROM memos WHERE deleted <= ? LIMIT ?) AS batch);`
+
+	return m.execCount(query, now().Add(-TrashRetention), limit)
+}
+
+// Execute a statement and return the number of rows it affected.
+func (m *MemoModel) execCount(query string, args ...any) (int64, error) {
+	result, err := m.DB.Exec(m.Dialect.rebind(query), args...)
 	if err != nil {
 		return 0, err
 	}
 
-	return int(id), nil
+	return result.RowsAffected()
 }
@@ -0,0 +1,90 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// A `Revision` is a previous version of a memo,
+// saved to the *memo_revisions* table whenever the memo is edited.
+type Revision struct {
+	ID      int
+	MemoID  int
+	Version int
+	UserID  int    // ID of the user who saved this version.
+	Author  string // Name of the user who saved this version.
+	Title   string
+	Content string
+	Created time.Time // When this version was saved.
+}
+
+// Return all versions of a memo, newest first.
+// The first element is always the current version of the memo itself.
+func (m *MemoModel) Revisions(memo Memo) ([]Revision, error) {
+	query := `SELECT r.id, r.memo_id, r.version, r.user_id, u.name, r.title, r.content, r.created
+	FROM memo_revisions r INNER JOIN users u ON u.id = r.user_id
+	WHERE r.memo_id = ? ORDER BY r.version DESC;`
+
+	rows, err := m.DB.Query(m.Dialect.rebind(query), memo.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []Revision{currentRevision(memo)}
+
+	for rows.Next() {
+		var r Revision
+		err = rows.Scan(&r.ID, &r.MemoID, &r.Version, &r.UserID, &r.Author, &r.Title, &r.Content, &r.Created)
+		if err != nil {
+			return nil, err
+		}
+
+		revisions = append(revisions, r)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return revisions, nil
+}
+
+// Return a single version of a memo.
+// If `version` is the current version, it's built from the memo itself.
+func (m *MemoModel) Revision(memo Memo, version int) (Revision, error) {
+	if version == memo.Version {
+		return currentRevision(memo), nil
+	}
+
+	query := `SELECT r.id, r.memo_id, r.version, r.user_id, u.name, r.title, r.content, r.created
+	FROM memo_revisions r INNER JOIN users u ON u.id = r.user_id
+	WHERE r.memo_id = ? AND r.version = ?;`
+
+	var r Revision
+	err := m.DB.QueryRow(m.Dialect.rebind(query), memo.ID, version).Scan(&r.ID, &r.MemoID, &r.Version, &r.UserID,
+		&r.Author, &r.Title, &r.Content, &r.Created)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Revision{}, ErrNoRecord
+		}
+		return Revision{}, err
+	}
+
+	return r, nil
+}
+
+// The current version of a memo lives in the *memos* table, not in *memo_revisions*.
+// Since only the owner can edit a memo, they're the author of the current version.
+func currentRevision(memo Memo) Revision {
+	return Revision{
+		MemoID:  memo.ID,
+		Version: memo.Version,
+		UserID:  memo.UserID,
+		Author:  memo.Author,
+		Title:   memo.Title,
+		Content: memo.Content,
+		Created: memo.Updated,
+	}
+}
@@ -0,0 +1,23 @@
+package models
+
+import "database/sql"
+
+// `SessionModel` wraps the connection pool holding the *sessions* table used by the session manager.
+// Reading & writing sessions is left to the session store from scs (mysqlstore, postgresstore or sqlite3store);
+// this only cleans up after it.
+type SessionModel struct {
+	DB      *sql.DB
+	Dialect *Dialect // nil means MySQL.
+}
+
+// Delete up to `limit` expired sessions.
+// Returns the number of sessions deleted.
+func (m *SessionModel) DeleteExpired(limit int) (int64, error) {
+	// Each session store keeps the expiry date in its own format, hence the query per dialect.
+	result, err := m.DB.Exec(m.Dialect.rebind(m.Dialect.orDefault().deleteExpiredSessions), limit)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
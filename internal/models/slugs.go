@@ -0,0 +1,29 @@
+package models
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"strings"
+)
+
+// How often `Insert` tries a new slug after a collision before giving up.
+const maxSlugAttempts = 5
+
+// Generate a random, URL-safe memo identifier.
+// 9 random bytes encode to 12 base64url characters (72 bits), so slugs can't be guessed or enumerated.
+func newSlug() (string, error) {
+	for {
+		b := make([]byte, 9)
+		_, err := rand.Read(b)
+		if err != nil {
+			return "", err
+		}
+
+		slug := base64.RawURLEncoding.EncodeToString(b)
+
+		// All-digit slugs would be mistaken for the numeric IDs of old memo URLs.
+		if strings.Trim(slug, "0123456789") != "" {
+			return slug, nil
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package models
+
+import "time"
+
+// `MemoStore` is what the application needs from a memo storage backend.
+// It's implemented by `MemoModel` (MySQL & SQLite) and `MemoryMemoStore`;
+// every implementation must pass the conformance tests in stores_test.go.
+type MemoStore interface {
+	Get(id int) (Memo, error)
+	GetBySlug(slug string) (Memo, error)
+	GetByLegacyID(id int) (Memo, error)
+	List(filter MemoFilter) (MemoPage, error)
+	Search(query string, userID, limit int) ([]Memo, error)
+	Tags(prefix string, userID, limit int) ([]string, error)
+	Insert(userID int, title, content string, expires time.Time, opts MemoOptions) (string, error)
+	Update(id, userID int, title, content string, expires time.Time, version int, opts MemoOptions) error
+	Burn(id int) (Memo, error)
+
+	Revisions(memo Memo) ([]Revision, error)
+	Revision(memo Memo, version int) (Revision, error)
+
+	Delete(id, userID int) error
+	Trash(userID int) ([]Memo, error)
+	Restore(id, userID int) error
+	Purge(id, userID int) error
+
+	DeleteExpired(limit int) (int64, error)
+	PurgeTrash(limit int) (int64, error)
+}
+
+// `UserStore` is what the application needs from a user storage backend.
+type UserStore interface {
+	Insert(name, email, password string) error
+	Authenticate(email, password string) (int, error)
+	Exists(id int) (bool, error)
+	Get(id int) (User, error)
+
+	// Personal access tokens authenticate programs; see tokens.go.
+	NewToken(userID int, name, scope string) (string, error)
+	AuthenticateToken(token string) (Token, error)
+	Tokens(userID int) ([]Token, error)
+	RevokeToken(id, userID int) error
+}
+
+// `SessionStore` cleans up after the session manager's store, if that doesn't clean up after itself.
+type SessionStore interface {
+	DeleteExpired(limit int) (int64, error)
+}
+
+// Make sure every backend implements the interfaces.
+var (
+	_ MemoStore    = (*MemoModel)(nil)
+	_ MemoStore    = (*MemoryMemoStore)(nil)
+	_ UserStore    = (*UserModel)(nil)
+	_ UserStore    = (*MemoryUserStore)(nil)
+	_ SessionStore = (*SessionModel)(nil)
+)
@@ -0,0 +1,779 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/heschmat/MemoBin/internal/assert"
+	"github.com/heschmat/MemoBin/internal/migrations"
+
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"modernc.org/sqlite"
+)
+
+// The conformance suite: every test below runs against each backend,
+// which must all behave the same.
+type backend struct {
+	name string
+	open func(t *testing.T) (MemoStore, UserStore)
+}
+
+// The backends to test. MySQL & PostgreSQL are only tested if `MEMOBIN_TEST_MYSQL_DSN`
+// or `MEMOBIN_TEST_POSTGRES_DSN` points to a scratch database. N.B. Its tables are emptied!
+func backends() []backend {
+	backends := []backend{
+		{"memory", func(t *testing.T) (MemoStore, UserStore) {
+			return NewMemoryStores()
+		}},
+		{"sqlite", func(t *testing.T) (MemoStore, UserStore) {
+			db := newTestSQLite(t)
+			return &MemoModel{DB: db, Dialect: SQLite}, &UserModel{DB: db, Dialect: SQLite}
+		}},
+		// Every query rebound the way it is for PostgreSQL, so typos in placeholders are caught
+		// without a PostgreSQL server (see `newTestNumberedSQLite()`).
+		{"sqlite-numbered", func(t *testing.T) (MemoStore, UserStore) {
+			db := newTestNumberedSQLite(t)
+			return &MemoModel{DB: db, Dialect: numberedSQLite}, &UserModel{DB: db, Dialect: numberedSQLite}
+		}},
+	}
+
+	if dsn := os.Getenv("MEMOBIN_TEST_MYSQL_DSN"); dsn != "" {
+		backends = append(backends, backend{"mysql", func(t *testing.T) (MemoStore, UserStore) {
+			db := newTestServerDB(t, "mysql", dsn, MySQL)
+			return &MemoModel{DB: db, Dialect: MySQL}, &UserModel{DB: db, Dialect: MySQL}
+		}})
+	}
+
+	if dsn := os.Getenv("MEMOBIN_TEST_POSTGRES_DSN"); dsn != "" {
+		backends = append(backends, backend{"postgres", func(t *testing.T) (MemoStore, UserStore) {
+			db := newTestServerDB(t, "pgx", dsn, Postgres)
+			return &MemoModel{DB: db, Dialect: Postgres}, &UserModel{DB: db, Dialect: Postgres}
+		}})
+	}
+
+	return backends
+}
+
+func newTestSQLite(t *testing.T) *sql.DB {
+	dsn := "file:" + filepath.Join(t.TempDir(), "test.db") + "?_pragma=foreign_keys(1)&_txlock=immediate"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	migrate(t, db, SQLite)
+	return db
+}
+
+// SQLite, with `$1`, `$2`, ... placeholders like PostgreSQL. SQLite binds `$N` to the Nth argument,
+// so a query with a missing or extra `?` fails, or reads the wrong argument.
+var numberedSQLite = func() *Dialect {
+	d := *SQLite
+	d.numberedParams = true
+	return &d
+}()
+
+func init() {
+	sql.Register("sqlite-numbered", numberedDriver{})
+}
+
+// A SQLite driver which rejects queries with `?` placeholders, i.e. those which weren't rebound.
+type numberedDriver struct{}
+
+func (numberedDriver) Open(dsn string) (driver.Conn, error) {
+	conn, err := (&sqlite.Driver{}).Open(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return numberedConn{conn}, nil
+}
+
+// Only embeds `driver.Conn`, so `database/sql` prepares every query (instead of using
+// the optional `ExecerContext` & co. of the SQLite connection).
+type numberedConn struct {
+	driver.Conn
+}
+
+func (c numberedConn) Prepare(query string) (driver.Stmt, error) {
+	if strings.Contains(query, "?") {
+		return nil, fmt.Errorf("query wasn't rebound: %s", query)
+	}
+	return c.Conn.Prepare(query)
+}
+
+func newTestNumberedSQLite(t *testing.T) *sql.DB {
+	dsn := "file:" + filepath.Join(t.TempDir(), "test.db") + "?_pragma=foreign_keys(1)&_txlock=immediate"
+
+	// The migrator binds its own queries for SQLite, so it gets a plain connection.
+	plain, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	migrate(t, plain, SQLite)
+	plain.Close()
+
+	db, err := sql.Open("sqlite-numbered", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// Bring the schema of a test database up to date.
+func migrate(t *testing.T, db *sql.DB, d *Dialect) {
+	m, err := migrations.New(db, d.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = m.Up(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Connect to a database server, migrate it and empty its tables.
+func newTestServerDB(t *testing.T, driverName, dsn string, d *Dialect) *sql.DB {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	migrate(t, db, d)
+
+	for _, table := range []string{"tokens", "memo_tags", "tags", "memo_revisions", "memos", "users"} {
+		_, err = db.Exec("DELETE FROM " + table)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db
+}
+
+// Run `test` against every backend, each starting out empty.
+func forEachBackend(t *testing.T, test func(t *testing.T, memos MemoStore, users UserStore)) {
+	for _, b := range backends() {
+		t.Run(b.name, func(t *testing.T) {
+			memos, users := b.open(t)
+			test(t, memos, users)
+		})
+	}
+}
+
+// Sign up a user and return their ID.
+func newTestUser(t *testing.T, users UserStore, name string) int {
+	t.Helper()
+
+	email := name + "@example.com"
+	err := users.Insert(name, email, "pa55word")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := users.Authenticate(email, "pa55word")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+// Create a memo and return it as stored.
+func newTestMemo(t *testing.T, memos MemoStore, userID int, title string, expires time.Time, opts MemoOptions) Memo {
+	t.Helper()
+
+	slug, err := memos.Insert(userID, title, "Content of "+title, expires, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	memo, err := memos.GetBySlug(slug)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return memo
+}
+
+func TestUserStore(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, memos MemoStore, users UserStore) {
+		id := newTestUser(t, users, "alice")
+
+		err := users.Insert("Alice again", "alice@example.com", "pa55word")
+		assert.Equal(t, err, ErrDuplicateEmail)
+
+		_, err = users.Authenticate("alice@example.com", "wrong")
+		assert.Equal(t, err, ErrInvalidCredentials)
+
+		_, err = users.Authenticate("bob@example.com", "pa55word")
+		assert.Equal(t, err, ErrInvalidCredentials)
+
+		exists, err := users.Exists(id)
+		assert.Equal(t, err, nil)
+		assert.Equal(t, exists, true)
+
+		exists, err = users.Exists(id + 1)
+		assert.Equal(t, err, nil)
+		assert.Equal(t, exists, false)
+
+		user, err := users.Get(id)
+		assert.Equal(t, err, nil)
+		assert.Equal(t, user.ID, id)
+		assert.Equal(t, user.Name, "alice")
+		assert.Equal(t, user.Email, "alice@example.com")
+		assert.Equal(t, user.Created.IsZero(), false)
+		assert.Equal(t, len(user.HashedPassword), 0)
+
+		_, err = users.Get(id + 1)
+		assert.Equal(t, err, ErrNoRecord)
+	})
+}
+
+func TestUserStoreTokens(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, memos MemoStore, users UserStore) {
+		aliceID := newTestUser(t, users, "alice")
+		bobID := newTestUser(t, users, "bob")
+
+		token, err := users.NewToken(aliceID, "Laptop", ScopeWrite)
+		assert.Equal(t, err, nil)
+		assert.Equal(t, strings.HasPrefix(token, tokenPrefix), true)
+		readToken, err := users.NewToken(aliceID, "CI", ScopeRead)
+		assert.Equal(t, err, nil)
+		bobToken, err := users.NewToken(bobID, "Laptop", ScopeWrite)
+		assert.Equal(t, err, nil)
+
+		// Newest first; not used yet.
+		tokens, err := users.Tokens(aliceID)
+		assert.Equal(t, err, nil)
+		assert.Equal(t, len(tokens), 2)
+		assert.Equal(t, tokens[0].Name, "CI")
+		assert.Equal(t, tokens[0].Scope, ScopeRead)
+		assert.Equal(t, tokens[0].UserID, aliceID)
+		assert.Equal(t, tokens[0].Created.IsZero(), false)
+		assert.Equal(t, tokens[0].LastUsed.IsZero(), true)
+		assert.Equal(t, tokens[1].Name, "Laptop")
+
+		// Authenticating records the use.
+		got, err := users.AuthenticateToken(readToken)
+		assert.Equal(t, err, nil)
+		assert.Equal(t, got.ID, tokens[0].ID)
+		assert.Equal(t, got.UserID, aliceID)
+		assert.Equal(t, got.Allows(ScopeRead), true)
+		assert.Equal(t, got.Allows(ScopeWrite), false)
+		tokens, err = users.Tokens(aliceID)
+		assert.Equal(t, err, nil)
+		assert.Equal(t, tokens[0].LastUsed.IsZero(), false)
+		assert.Equal(t, tokens[1].LastUsed.IsZero(), true)
+
+		got, err = users.AuthenticateToken(bobToken)
+		assert.Equal(t, err, nil)
+		assert.Equal(t, got.UserID, bobID)
+		assert.Equal(t, got.Allows(ScopeWrite), true)
+
+		_, err = users.AuthenticateToken(token + "x")
+		assert.Equal(t, err, ErrInvalidCredentials)
+		_, err = users.AuthenticateToken("")
+		assert.Equal(t, err, ErrInvalidCredentials)
+
+		// Only the owner can revoke a token.
+		err = users.RevokeToken(tokens[1].ID, bobID)
+		assert.Equal(t, err, ErrNoRecord)
+		err = users.RevokeToken(tokens[1].ID, aliceID)
+		assert.Equal(t, err, nil)
+		err = users.RevokeToken(tokens[1].ID, aliceID)
+		assert.Equal(t, err, ErrNoRecord)
+
+		_, err = users.AuthenticateToken(token)
+		assert.Equal(t, err, ErrInvalidCredentials)
+		_, err = users.AuthenticateToken(readToken)
+		assert.Equal(t, err, nil)
+		tokens, err = users.Tokens(aliceID)
+		assert.Equal(t, err, nil)
+		assert.Equal(t, len(tokens), 1)
+	})
+}
+
+func TestMemoStoreGet(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, memos MemoStore, users UserStore) {
+		userID := newTestUser(t, users, "alice")
+		expires := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+
+		memo := newTestMemo(t, memos, userID, "First", expires, MemoOptions{})
+		assert.Equal(t, len(memo.Slug), 12)
+		assert.Equal(t, memo.UserID, userID)
+		assert.Equal(t, memo.Author, "alice")
+		assert.Equal(t, memo.Title, "First")
+		assert.Equal(t, memo.Content, "Content of First")
+		assert.Equal(t, memo.Expires.Equal(expires), true)
+		assert.Equal(t, memo.Updated.Equal(memo.Created), true)
+		assert.Equal(t, memo.Version, 1)
+		assert.Equal(t, memo.Visibility, VisibilityPublic)
+		assert.Equal(t, memo.HasPassword(), false)
+
+		byID, err := memos.Get(memo.ID)
+		assert.Equal(t, err, nil)
+		assert.Equal(t, byID.Slug, memo.Slug)
+
+		never := newTestMemo(t, memos, userID, "Forever", time.Time{}, MemoOptions{})
+		assert.Equal(t, never.Expires.IsZero(), true)
+
+		// Memos created since slugs were introduced can't be found by their ID.
+		_, err = memos.GetByLegacyID(memo.ID)
+		assert.Equal(t, err, ErrNoRecord)
+
+		_, err = memos.GetBySlug("doesnotexist")
+		assert.Equal(t, err, ErrNoRecord)
+
+		slug, err := memos.Insert(userID, "Expired", "Gone", time.Now().Add(-time.Hour), MemoOptions{})
+		assert.Equal(t, err, nil)
+		_, err = memos.GetBySlug(slug)
+		assert.Equal(t, err, ErrNoRecord)
+	})
+}
+
+func TestMemoStorePassword(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, memos MemoStore, users UserStore) {
+		userID := newTestUser(t, users, "alice")
+
+		memo := newTestMemo(t, memos, userID, "Secret", time.Time{}, MemoOptions{Password: "open sesame"})
+		assert.Equal(t, memo.HasPassword(), true)
+		assert.Equal(t, memo.CheckPassword("open sesame"), nil)
+		assert.Equal(t, memo.CheckPassword("wrong"), ErrInvalidCredentials)
+	})
+}
+
+// The titles of the memos on a page, joined for easy comparison.
+func pageTitles(page MemoPage) string {
+	var titles []string
+	for _, memo := range page.Memos {
+		titles = append(titles, memo.Title)
+	}
+	return strings.Join(titles, ", ")
+}
+
+func TestMemoStoreList(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, memos MemoStore, users UserStore) {
+		aliceID := newTestUser(t, users, "alice")
+		bobID := newTestUser(t, users, "bob")
+
+		// Five memos expiring an hour apart, in a different order than they're created & named.
+		for i, n := range []int{3, 1, 4, 5, 2} {
+			newTestMemo(t, memos, aliceID, fmt.Sprintf("m%d", n), time.Now().Add(time.Duration(6-i)*time.Hour), MemoOptions{})
+		}
+		newTestMemo(t, memos, bobID, "m6", time.Time{}, MemoOptions{})
+		newTestMemo(t, memos, aliceID, "Unlisted", time.Time{}, MemoOptions{Visibility: VisibilityUnlisted})
+		newTestMemo(t, memos, aliceID, "Private", time.Time{}, MemoOptions{Visibility: VisibilityPrivate})
+
+		list := func(filter MemoFilter) MemoPage {
+			t.Helper()
+			page, err := memos.List(filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return page
+		}
+
+		page := list(MemoFilter{})
+		assert.Equal(t, pageTitles(page), "m6, m2, m5, m4, m1, m3")
+		assert.Equal(t, page.Memos[0].Author, "bob")
+		assert.Equal(t, page.Prev, "")
+		assert.Equal(t, page.Next, "")
+
+		// Page through the memos, then back again.
+		page = list(MemoFilter{Limit: 4})
+		assert.Equal(t, pageTitles(page), "m6, m2, m5, m4")
+		assert.Equal(t, page.Prev, "")
+
+		page = list(MemoFilter{Limit: 4, Cursor: page.Next})
+		assert.Equal(t, pageTitles(page), "m1, m3")
+		assert.Equal(t, page.Next, "")
+
+		page = list(MemoFilter{Limit: 4, Cursor: page.Prev})
+		assert.Equal(t, pageTitles(page), "m6, m2, m5, m4")
+		assert.Equal(t, page.Prev, "")
+		assert.Equal(t, page.Next != "", true)
+
+		tests := []struct {
+			name   string
+			filter MemoFilter
+			want   string
+		}{
+			{"Oldest", MemoFilter{Sort: SortOldest}, "m3, m1, m4, m5, m2, m6"},
+			{"Title", MemoFilter{Sort: SortTitle}, "m1, m2, m3, m4, m5, m6"},
+			{"Expires", MemoFilter{Sort: SortExpires}, "m2, m5, m4, m1, m3, m6"},
+			{"Author", MemoFilter{Author: "bob"}, "m6"},
+			{"Unknown author", MemoFilter{Author: "carol"}, ""},
+			{"Expiring soon", MemoFilter{Sort: SortExpires, ExpiresBefore: time.Now().Add(210 * time.Minute)}, "m2, m5"},
+			{"Created later", MemoFilter{CreatedFrom: time.Now().Add(time.Hour)}, ""},
+			{"Created earlier", MemoFilter{CreatedUntil: time.Now().Add(-time.Hour)}, ""},
+			{"Created today", MemoFilter{CreatedFrom: time.Now().Add(-time.Hour), CreatedUntil: time.Now().Add(time.Hour)}, "m6, m2, m5, m4, m1, m3"},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				assert.Equal(t, pageTitles(list(tt.filter)), tt.want)
+
+				// Paging two memos at a time gives the same order.
+				var titles []string
+				filter := tt.filter
+				filter.Limit = 2
+				for {
+					page := list(filter)
+					if len(page.Memos) > 0 {
+						titles = append(titles, pageTitles(page))
+					}
+					if page.Next == "" {
+						break
+					}
+					filter.Cursor = page.Next
+				}
+				assert.Equal(t, strings.Join(titles, ", "), tt.want)
+			})
+		}
+
+		// Cursors only work for the sort order they were made for.
+		page = list(MemoFilter{Limit: 2})
+		_, err := memos.List(MemoFilter{Limit: 2, Sort: SortTitle, Cursor: page.Next})
+		assert.Equal(t, err, ErrInvalidCursor)
+		_, err = memos.List(MemoFilter{Cursor: "not-a-cursor"})
+		assert.Equal(t, err, ErrInvalidCursor)
+	})
+}
+
+func TestMemoStoreUpdate(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, memos MemoStore, users UserStore) {
+		aliceID := newTestUser(t, users, "alice")
+		bobID := newTestUser(t, users, "bob")
+
+		memo := newTestMemo(t, memos, aliceID, "v1", time.Time{}, MemoOptions{Language: "go"})
+		assert.Equal(t, memo.Language, "go")
+		assert.Equal(t, memo.Format, FormatPlain)
+
+		// Only the owner may edit a memo.
+		err := memos.Update(memo.ID, bobID, "v2", "", time.Time{}, 1, MemoOptions{})
+		assert.Equal(t, err, ErrNoRecord)
+
+		err = memos.Update(memo.ID, aliceID, "v2", "Changed", time.Time{}, 1, MemoOptions{Visibility: VisibilityUnlisted, Language: "python", Format: FormatMarkdown})
+		assert.Equal(t, err, nil)
+
+		// A second edit starting from version 1 is a conflict.
+		err = memos.Update(memo.ID, aliceID, "v2 again", "", time.Time{}, 1, MemoOptions{})
+		assert.Equal(t, err, ErrEditConflict)
+
+		// An empty visibility (or language, or format) keeps the current one.
+		err = memos.Update(memo.ID, aliceID, "v3", "Changed again", time.Time{}, 2, MemoOptions{})
+		assert.Equal(t, err, nil)
+
+		memo, err = memos.Get(memo.ID)
+		assert.Equal(t, err, nil)
+		assert.Equal(t, memo.Title, "v3")
+		assert.Equal(t, memo.Version, 3)
+		assert.Equal(t, memo.Visibility, VisibilityUnlisted)
+		assert.Equal(t, memo.Language, "python")
+		assert.Equal(t, memo.Format, FormatMarkdown)
+
+		revisions, err := memos.Revisions(memo)
+		assert.Equal(t, err, nil)
+		assert.Equal(t, len(revisions), 3)
+		for i, title := range []string{"v3", "v2", "v1"} {
+			assert.Equal(t, revisions[i].Title, title)
+			assert.Equal(t, revisions[i].Version, 3-i)
+			assert.Equal(t, revisions[i].Author, "alice")
+		}
+
+		revision, err := memos.Revision(memo, 1)
+		assert.Equal(t, err, nil)
+		assert.Equal(t, revision.Title, "v1")
+		assert.Equal(t, revision.Content, "Content of v1")
+
+		_, err = memos.Revision(memo, 4)
+		assert.Equal(t, err, ErrNoRecord)
+	})
+}
+
+func TestMemoStoreBurn(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, memos MemoStore, users UserStore) {
+		userID := newTestUser(t, users, "alice")
+
+		normal := newTestMemo(t, memos, userID, "Normal", time.Time{}, MemoOptions{})
+		_, err := memos.Burn(normal.ID)
+		assert.Equal(t, err, ErrNoRecord)
+
+		burn := newTestMemo(t, memos, userID, "Burn", time.Time{}, MemoOptions{BurnAfterReading: true})
+		assert.Equal(t, burn.BurnAfterReading, true)
+
+		memo, err := memos.Burn(burn.ID)
+		assert.Equal(t, err, nil)
+		assert.Equal(t, memo.Title, "Burn")
+
+		_, err = memos.Burn(burn.ID)
+		assert.Equal(t, err, ErrNoRecord)
+		_, err = memos.Get(burn.ID)
+		assert.Equal(t, err, ErrNoRecord)
+	})
+}
+
+func TestMemoStoreTrash(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, memos MemoStore, users UserStore) {
+		aliceID := newTestUser(t, users, "alice")
+		bobID := newTestUser(t, users, "bob")
+
+		memo := newTestMemo(t, memos, aliceID, "Trash me", time.Time{}, MemoOptions{})
+
+		err := memos.Delete(memo.ID, bobID)
+		assert.Equal(t, err, ErrNoRecord)
+
+		err = memos.Delete(memo.ID, aliceID)
+		assert.Equal(t, err, nil)
+
+		_, err = memos.Get(memo.ID)
+		assert.Equal(t, err, ErrNoRecord)
+
+		trash, err := memos.Trash(aliceID)
+		assert.Equal(t, err, nil)
+		assert.Equal(t, len(trash), 1)
+		assert.Equal(t, trash[0].ID, memo.ID)
+		assert.Equal(t, trash[0].Deleted.IsZero(), false)
+
+		trash, err = memos.Trash(bobID)
+		assert.Equal(t, err, nil)
+		assert.Equal(t, len(trash), 0)
+
+		err = memos.Restore(memo.ID, bobID)
+		assert.Equal(t, err, ErrNoRecord)
+
+		err = memos.Restore(memo.ID, aliceID)
+		assert.Equal(t, err, nil)
+
+		_, err = memos.Get(memo.ID)
+		assert.Equal(t, err, nil)
+
+		// Only memos in the trash can be purged.
+		err = memos.Purge(memo.ID, aliceID)
+		assert.Equal(t, err, ErrNoRecord)
+
+		err = memos.Delete(memo.ID, aliceID)
+		assert.Equal(t, err, nil)
+		err = memos.Purge(memo.ID, aliceID)
+		assert.Equal(t, err, nil)
+
+		err = memos.Restore(memo.ID, aliceID)
+		assert.Equal(t, err, ErrNoRecord)
+	})
+}
+
+func TestMemoStoreSweep(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, memos MemoStore, users UserStore) {
+		userID := newTestUser(t, users, "alice")
+
+		for i := 0; i < 3; i++ {
+			_, err := memos.Insert(userID, "Expired", "Gone", time.Now().Add(-time.Minute), MemoOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		live := newTestMemo(t, memos, userID, "Live", time.Now().Add(time.Hour), MemoOptions{})
+		never := newTestMemo(t, memos, userID, "Never", time.Time{}, MemoOptions{})
+
+		n, err := memos.DeleteExpired(2)
+		assert.Equal(t, err, nil)
+		assert.Equal(t, n, int64(2))
+
+		n, err = memos.DeleteExpired(2)
+		assert.Equal(t, err, nil)
+		assert.Equal(t, n, int64(1))
+
+		n, err = memos.DeleteExpired(2)
+		assert.Equal(t, err, nil)
+		assert.Equal(t, n, int64(0))
+
+		for _, memo := range []Memo{live, never} {
+			_, err = memos.Get(memo.ID)
+			assert.Equal(t, err, nil)
+		}
+
+		// Freshly trashed memos are kept for `TrashRetention`.
+		err = memos.Delete(live.ID, userID)
+		assert.Equal(t, err, nil)
+
+		n, err = memos.PurgeTrash(10)
+		assert.Equal(t, err, nil)
+		assert.Equal(t, n, int64(0))
+	})
+}
+
+func TestMemoStoreSearch(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, memos MemoStore, users UserStore) {
+		aliceID := newTestUser(t, users, "alice")
+		bobID := newTestUser(t, users, "bob")
+
+		insert := func(userID int, title, content string, expires time.Time, opts MemoOptions) int {
+			slug, err := memos.Insert(userID, title, content, expires, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			memo, err := memos.GetBySlug(slug)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return memo.ID
+		}
+		// The titles of the memos found, joined for easy comparison.
+		titles := func(query string, userID int) string {
+			found, err := memos.Search(query, userID, 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var titles []string
+			for _, memo := range found {
+				titles = append(titles, memo.Title)
+			}
+			return strings.Join(titles, ", ")
+		}
+
+		insert(aliceID, "Shopping list", "Bread, butter and a jar of marmalade.", time.Time{}, MemoOptions{})
+		insert(aliceID, "Marmalade recipe", "Boil the oranges, then add sugar until the marmalade sets.", time.Time{}, MemoOptions{})
+		insert(aliceID, "Unlisted marmalade", "Not for everyone.", time.Time{}, MemoOptions{Visibility: VisibilityUnlisted})
+		insert(aliceID, "Private marmalade", "Only for alice.", time.Time{}, MemoOptions{Visibility: VisibilityPrivate})
+		insert(aliceID, "Locked marmalade", "Behind a password.", time.Time{}, MemoOptions{Password: "open sesame"})
+		insert(aliceID, "Burning marmalade", "Read once.", time.Time{}, MemoOptions{BurnAfterReading: true})
+		_, err := memos.Insert(aliceID, "Expired marmalade", "Gone.", time.Now().Add(-time.Hour), MemoOptions{})
+		assert.Equal(t, err, nil)
+		trashed := insert(aliceID, "Trashed marmalade", "Deleted.", time.Time{}, MemoOptions{})
+		err = memos.Delete(trashed, aliceID)
+		assert.Equal(t, err, nil)
+
+		// Matches in the title rank first; only memos anyone could read are found.
+		assert.Equal(t, titles("Marmalade", 0), "Marmalade recipe, Shopping list")
+		assert.Equal(t, titles("marmalade", bobID), "Marmalade recipe, Shopping list")
+
+		// Every term must match.
+		assert.Equal(t, titles("marmalade sugar", 0), "Marmalade recipe")
+		assert.Equal(t, titles("marmalade toast", 0), "")
+
+		// The owner finds all their live memos.
+		assert.Equal(t, strings.Count(titles("marmalade", aliceID), ",")+1, 6)
+
+		// Punctuation can't break the query.
+		assert.Equal(t, titles(`"butter" AND -(bread*`, 0), "Shopping list")
+		assert.Equal(t, titles(" ?! ", 0), "")
+
+		// Edits are searchable straight away.
+		memo, err := memos.Get(insert(bobID, "Breakfast", "Toast.", time.Time{}, MemoOptions{}))
+		assert.Equal(t, err, nil)
+		err = memos.Update(memo.ID, bobID, "Breakfast", "Toast with marmalade.", time.Time{}, memo.Version, MemoOptions{})
+		assert.Equal(t, err, nil)
+		assert.Equal(t, titles("toast", 0), "Breakfast")
+
+		found, err := memos.Search("marmalade", 0, 2)
+		assert.Equal(t, err, nil)
+		assert.Equal(t, len(found), 2)
+		assert.Equal(t, found[0].Author, "alice")
+	})
+}
+
+func TestMemoStoreTags(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, memos MemoStore, users UserStore) {
+		aliceID := newTestUser(t, users, "alice")
+		bobID := newTestUser(t, users, "bob")
+
+		memo := newTestMemo(t, memos, aliceID, "Tagged", time.Time{}, MemoOptions{Tags: []string{"go", "databases", "go"}})
+		assert.Equal(t, strings.Join(memo.Tags, ","), "databases,go")
+
+		untagged := newTestMemo(t, memos, aliceID, "Untagged", time.Time{}, MemoOptions{})
+		assert.Equal(t, len(untagged.Tags), 0)
+
+		newTestMemo(t, memos, bobID, "Also go", time.Time{}, MemoOptions{Tags: []string{"go"}})
+		newTestMemo(t, memos, bobID, "Secret", time.Time{}, MemoOptions{Tags: []string{"gossip"}, Visibility: VisibilityPrivate})
+
+		page, err := memos.List(MemoFilter{Tag: "go"})
+		assert.Equal(t, err, nil)
+		assert.Equal(t, pageTitles(page), "Also go, Tagged")
+		assert.Equal(t, strings.Join(page.Memos[1].Tags, ","), "databases,go")
+
+		// Private memos are never listed, not even by tag.
+		page, err = memos.List(MemoFilter{Tag: "gossip"})
+		assert.Equal(t, err, nil)
+		assert.Equal(t, pageTitles(page), "")
+
+		// Suggestions: most used first, only from memos the user may find.
+		tags, err := memos.Tags("G", 0, 10)
+		assert.Equal(t, err, nil)
+		assert.Equal(t, strings.Join(tags, ","), "go")
+
+		tags, err = memos.Tags("go", bobID, 10)
+		assert.Equal(t, err, nil)
+		assert.Equal(t, strings.Join(tags, ","), "go,gossip")
+
+		tags, err = memos.Tags("", 0, 1)
+		assert.Equal(t, err, nil)
+		assert.Equal(t, strings.Join(tags, ","), "go")
+
+		// LIKE wildcards in the prefix are taken literally.
+		tags, err = memos.Tags("%", 0, 10)
+		assert.Equal(t, err, nil)
+		assert.Equal(t, len(tags), 0)
+
+		// nil keeps the tags, an empty list removes them.
+		err = memos.Update(memo.ID, aliceID, "Tagged", "Edited", time.Time{}, 1, MemoOptions{})
+		assert.Equal(t, err, nil)
+		memo, err = memos.Get(memo.ID)
+		assert.Equal(t, err, nil)
+		assert.Equal(t, strings.Join(memo.Tags, ","), "databases,go")
+
+		err = memos.Update(memo.ID, aliceID, "Tagged", "Edited", time.Time{}, 2, MemoOptions{Tags: []string{"sql"}})
+		assert.Equal(t, err, nil)
+		memo, err = memos.Get(memo.ID)
+		assert.Equal(t, err, nil)
+		assert.Equal(t, strings.Join(memo.Tags, ","), "sql")
+
+		err = memos.Update(memo.ID, aliceID, "Tagged", "Edited", time.Time{}, 3, MemoOptions{Tags: []string{}})
+		assert.Equal(t, err, nil)
+		memo, err = memos.Get(memo.ID)
+		assert.Equal(t, err, nil)
+		assert.Equal(t, len(memo.Tags), 0)
+
+		// Burnt memos are returned with their tags.
+		burn := newTestMemo(t, memos, aliceID, "Burn", time.Time{}, MemoOptions{BurnAfterReading: true, Tags: []string{"once"}})
+		burnt, err := memos.Burn(burn.ID)
+		assert.Equal(t, err, nil)
+		assert.Equal(t, strings.Join(burnt.Tags, ","), "once")
+
+		tags, err = memos.Tags("once", aliceID, 10)
+		assert.Equal(t, err, nil)
+		assert.Equal(t, len(tags), 0)
+	})
+}
+
+func TestParseTags(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		want string
+	}{
+		{"Commas", "go, sql,web", "go,sql,web"},
+		{"Spaces", "  go  sql\tweb ", "go,sql,web"},
+		{"Hashes & case", "#Go, #SQL", "go,sql"},
+		{"Duplicates", "go, Go, go", "go"},
+		{"Empty", " , ,", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tags := ParseTags(tt.s)
+			assert.Equal(t, tags != nil, true)
+			assert.Equal(t, strings.Join(tags, ","), tt.want)
+		})
+	}
+}
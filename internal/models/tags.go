@@ -0,0 +1,153 @@
+package models
+
+import (
+	"database/sql"
+	"slices"
+	"strings"
+)
+
+// Limits on the tags of a memo; tags are checked against them (and `validator.TagRX`) before they're stored.
+const (
+	MaxTags      = 5
+	MaxTagLength = 30
+)
+
+// Split a comma- (or space-) separated list of tags, as typed into a form,
+// into lower-case tags without duplicates. Returns an empty (not nil) slice if there are none.
+func ParseTags(s string) []string {
+	tags := []string{}
+	for _, tag := range strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t' || r == '\n' || r == '\r'
+	}) {
+		tag = strings.TrimPrefix(tag, "#")
+		if tag != "" && !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// Return the tags sorted & without duplicates, the way they're returned from the stores (nil if there are none).
+func sortedTags(tags []string) []string {
+	if len(tags) == 0 {
+		return nil
+	}
+	tags = slices.Clone(tags)
+	slices.Sort(tags)
+	return slices.Compact(tags)
+}
+
+// Anything which can run a query: *sql.DB or *sql.Tx.
+type querier interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+}
+
+// Fill in the tags of `memos` (sorted by name), with a single query.
+func (m *MemoModel) loadTags(q querier, memos []Memo) error {
+	if len(memos) == 0 {
+		return nil
+	}
+
+	args := make([]any, len(memos))
+	for i, memo := range memos {
+		args[i] = memo.ID
+	}
+	placeholders := strings.Repeat("?, ", len(memos)-1) + "?"
+
+	query := `SELECT mt.memo_id, t.name FROM memo_tags mt INNER JOIN tags t ON t.id = mt.tag_id
+	WHERE mt.memo_id IN (` + placeholders + `)
+	ORDER BY t.name;`
+
+	rows, err := q.Query(m.Dialect.rebind(query), args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	tags := make(map[int][]string)
+	for rows.Next() {
+		var memoID int
+		var name string
+		err = rows.Scan(&memoID, &name)
+		if err != nil {
+			return err
+		}
+		tags[memoID] = append(tags[memoID], name)
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	for i := range memos {
+		memos[i].Tags = tags[memos[i].ID]
+	}
+	return nil
+}
+
+// Fill in the tags of a single memo.
+func (m *MemoModel) withTags(memo Memo) (Memo, error) {
+	memos := []Memo{memo}
+	err := m.loadTags(m.DB, memos)
+	return memos[0], err
+}
+
+// Replace the tags of a memo with `tags`, creating the tags which don't exist yet.
+func (m *MemoModel) setTags(tx *sql.Tx, memoID int, tags []string) error {
+	_, err := tx.Exec(m.Dialect.rebind(`DELETE FROM memo_tags WHERE memo_id = ?;`), memoID)
+	if err != nil {
+		return err
+	}
+
+	for _, tag := range sortedTags(tags) {
+		_, err = tx.Exec(m.Dialect.rebind(m.Dialect.orDefault().insertTag), tag)
+		if err != nil {
+			return err
+		}
+
+		var tagID int
+		err = tx.QueryRow(m.Dialect.rebind(`SELECT id FROM tags WHERE name = ?;`), tag).Scan(&tagID)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(m.Dialect.rebind(`INSERT INTO memo_tags (memo_id, tag_id) VALUES (?, ?);`), memoID, tagID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Return up to `limit` tags starting with `prefix`, most used first, for autocompletion.
+// Only tags of memos `userID` (0 for anonymous users) could find in a listing, or owns, are suggested.
+func (m *MemoModel) Tags(prefix string, userID, limit int) ([]string, error) {
+	// `!` escapes the wildcards of LIKE (the same way in every database).
+	escaped := strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(strings.ToLower(prefix))
+
+	query := `SELECT t.name FROM tags t
+	INNER JOIN memo_tags mt ON mt.tag_id = t.id
+	INNER JOIN memos m ON m.id = mt.memo_id
+	WHERE t.name LIKE ? ESCAPE '!' AND (m.expires IS NULL OR m.expires > ?) AND m.deleted IS NULL
+	AND (m.visibility = 'public' OR m.user_id = ?)
+	GROUP BY t.name
+	ORDER BY COUNT(*) DESC, t.name LIMIT ?;`
+
+	rows, err := m.DB.Query(m.Dialect.rebind(query), escaped+"%", now(), userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tags []string
+	for rows.Next() {
+		var name string
+		err = rows.Scan(&name)
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, name)
+	}
+
+	return tags, rows.Err()
+}
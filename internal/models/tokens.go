@@ -0,0 +1,170 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+)
+
+// A personal access token, which authenticates programs (e.g. `curl`) as its owner instead of a session.
+// The token itself is never stored, only its hash.
+type Token struct {
+	ID       int
+	UserID   int
+	Name     string // Chosen by the owner, to tell their tokens apart.
+	Scope    string // One of `Scopes`.
+	Created  time.Time
+	LastUsed time.Time // Zero if the token has never been used.
+}
+
+// What a token is allowed to do.
+const (
+	ScopeRead  = "read"  // read memos through the API
+	ScopeWrite = "write" // also create, edit & delete them
+)
+
+// All scopes, from the least to the most powerful.
+var Scopes = []string{ScopeRead, ScopeWrite}
+
+// Whether the token is allowed to do what `scope` allows.
+func (t Token) Allows(scope string) bool {
+	return t.Scope == ScopeWrite || t.Scope == scope
+}
+
+// Limits on the tokens of a user; checked before they're stored.
+const (
+	MaxTokens          = 20
+	MaxTokenNameLength = 100
+)
+
+// How often the last time a token was used is recorded (at most),
+// so using a token doesn't mean writing to the database on every single request.
+const tokenUseResolution = time.Minute
+
+// Tokens start with a prefix, so they're easy to recognise (e.g. by secret scanners).
+const tokenPrefix = "memobin_"
+
+// Generate a new random token, and the hash it's stored as.
+// Tokens are 256 random bits, so a fast hash is enough; unlike passwords, they can't be guessed.
+func generateToken() (token, hash string, err error) {
+	b := make([]byte, 32)
+	_, err = rand.Read(b)
+	if err != nil {
+		return "", "", err
+	}
+
+	token = tokenPrefix + base64.RawURLEncoding.EncodeToString(b)
+	return token, hashToken(token), nil
+}
+
+// The hex-encoded SHA-256 hash of a token, as stored in the *tokens* table.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Generate a new token for the user, with the given name & scope.
+// The token itself isn't stored, so this is the only time it's available.
+func (m *UserModel) NewToken(userID int, name, scope string) (string, error) {
+	token, hash, err := generateToken()
+	if err != nil {
+		return "", err
+	}
+
+	query := `INSERT INTO tokens (user_id, name, scope, hash, created) VALUES (?, ?, ?, ?, ?);`
+
+	_, err = m.DB.Exec(m.Dialect.rebind(query), userID, name, scope, hash, now())
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// The columns selected by every query returning tokens, in the order expected by `scanToken()`.
+const tokenColumns = `id, user_id, name, scope, created, last_used`
+
+func scanToken(row interface{ Scan(...any) error }) (Token, error) {
+	var t Token
+	var lastUsed sql.NullTime
+	err := row.Scan(&t.ID, &t.UserID, &t.Name, &t.Scope, &t.Created, &lastUsed)
+	if err != nil {
+		return Token{}, err
+	}
+	t.LastUsed = lastUsed.Time
+	return t, nil
+}
+
+// Return the token, and record that it's been used.
+// Returns `ErrInvalidCredentials` if there's no such token (e.g. because it's been revoked).
+func (m *UserModel) AuthenticateToken(token string) (Token, error) {
+	if !strings.HasPrefix(token, tokenPrefix) {
+		return Token{}, ErrInvalidCredentials
+	}
+
+	query := `SELECT ` + tokenColumns + ` FROM tokens WHERE hash = ?;`
+
+	t, err := scanToken(m.DB.QueryRow(m.Dialect.rebind(query), hashToken(token)))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Token{}, ErrInvalidCredentials
+		}
+		return Token{}, err
+	}
+
+	used := now()
+	if used.Sub(t.LastUsed) >= tokenUseResolution {
+		_, err = m.DB.Exec(m.Dialect.rebind(`UPDATE tokens SET last_used = ? WHERE id = ?;`), used, t.ID)
+		if err != nil {
+			return Token{}, err
+		}
+		t.LastUsed = used
+	}
+
+	return t, nil
+}
+
+// Return the tokens of a user, newest first.
+func (m *UserModel) Tokens(userID int) ([]Token, error) {
+	query := `SELECT ` + tokenColumns + ` FROM tokens WHERE user_id = ? ORDER BY created DESC, id DESC;`
+
+	rows, err := m.DB.Query(m.Dialect.rebind(query), userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []Token
+	for rows.Next() {
+		t, err := scanToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, t)
+	}
+
+	return tokens, rows.Err()
+}
+
+// Delete one of the user's tokens, so it can't be used anymore.
+// Returns `ErrNoRecord` if the user has no such token.
+func (m *UserModel) RevokeToken(id, userID int) error {
+	result, err := m.DB.Exec(m.Dialect.rebind(`DELETE FROM tokens WHERE id = ? AND user_id = ?;`), id, userID)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNoRecord
+	}
+	return nil
+}
@@ -3,10 +3,8 @@ package models
 import (
 	"database/sql"
 	"errors"
-	"strings"
 	"time"
 
-	"github.com/go-sql-driver/mysql"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -21,7 +19,8 @@ type User struct {
 
 // This wraps a database connection pool.
 type UserModel struct {
-	DB *sql.DB
+	DB      *sql.DB
+	Dialect *Dialect // nil means MySQL.
 }
 
 // Add a new record to the *users* table.
@@ -33,19 +32,15 @@ func (m *UserModel) Insert(name, email, password string) error {
 	}
 
 	q := `INSERT INTO users (name, email, hashed_password, created)
-	VALUES(?, ?, ?, UTC_TIMESTAMP())`
+	VALUES(?, ?, ?, ?)`
 
-	_, err = m.DB.Exec(q, name, email, string(hashedPassword))
+	_, err = m.DB.Exec(m.Dialect.rebind(q), name, email, string(hashedPassword), now())
 	if err != nil {
-		var mySQLError *mysql.MySQLError
-		// N.B. The *mySQLError* variable is initialized to *nil*.
-		// It gets populated ONLY IF `errors.As` detects that *err* is of type `*mysql.MySQLError`.
-		// If `errors.As` succeeds, it assigns the underlying `*mysql.MySQLError` object to *mySQLError*,
-		// enabling the function to access its `Number` & `Message` fields for detailed error handling.
-		if errors.As(err, &mySQLError) {
-			if mySQLError.Number == 162 && strings.Contains(mySQLError.Message, "users_uc_email") {
-				return ErrDuplicateEmail
-			}
+		// The email is the only unique column we insert (the ID is generated),
+		// so any unique constraint violation means the email is taken.
+		// The dialect knows how its driver reports it (e.g. `*mysql.MySQLError` number 1062).
+		if m.Dialect.orDefault().isDuplicate(err) {
+			return ErrDuplicateEmail
 		}
 		return err
 	}
@@ -59,7 +54,7 @@ func (m *UserModel) Authenticate(email, password string) (int, error) {
 
 	q := "SELECT id, hashed_password FROM users WHERE email = ?;"
 
-	err := m.DB.QueryRow(q, email).Scan(&id, &hashedPassword)
+	err := m.DB.QueryRow(m.Dialect.rebind(q), email).Scan(&id, &hashedPassword)
 	// If now matchin email found, return error.
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -82,3 +77,31 @@ func (m *UserModel) Authenticate(email, password string) (int, error) {
 	// Otherwise, the password is correct. Return the user ID.
 	return id, nil
 }
+
+// Check whether a user with the given ID exists (e.g., hasn't been deleted since logging in).
+func (m *UserModel) Exists(id int) (bool, error) {
+	var exists bool
+
+	q := "SELECT EXISTS(SELECT true FROM users WHERE id = ?);"
+
+	err := m.DB.QueryRow(m.Dialect.rebind(q), id).Scan(&exists)
+	return exists, err
+}
+
+// Return the user with the given ID (without the password hash).
+// Returns `ErrNoRecord` if there's no such user.
+func (m *UserModel) Get(id int) (User, error) {
+	var user User
+
+	q := "SELECT id, name, email, created FROM users WHERE id = ?;"
+
+	err := m.DB.QueryRow(m.Dialect.rebind(q), id).Scan(&user.ID, &user.Name, &user.Email, &user.Created)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return User{}, ErrNoRecord
+		}
+		return User{}, err
+	}
+
+	return user, nil
+}
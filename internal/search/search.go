@@ -0,0 +1,261 @@
+// Package search splits search queries into terms, highlights them in text
+// and provides an in-process full-text index for backends whose database has no full-text search.
+package search
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// At most this many terms of a query are searched for; the rest are ignored.
+const MaxTerms = 10
+
+// Split `text` into lower-case words: runs of letters & digits.
+func words(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// Terms returns the distinct words of a query, lower-cased, in order.
+// Anything but letters & digits separates words, so the terms are safe to embed
+// in the query syntax of the databases' full-text search.
+func Terms(query string) []string {
+	var terms []string
+	seen := make(map[string]bool)
+	for _, w := range words(query) {
+		if seen[w] {
+			continue
+		}
+		seen[w] = true
+		terms = append(terms, w)
+		if len(terms) == MaxTerms {
+			break
+		}
+	}
+	return terms
+}
+
+// A Segment is a piece of highlighted text; `Match` is true if it's one of the search terms.
+type Segment struct {
+	Text  string
+	Match bool
+}
+
+// Highlight splits `text` into segments, marking the words which are one of `terms` (case-insensitively).
+func Highlight(text string, terms []string) []Segment {
+	match := make(map[string]bool, len(terms))
+	for _, t := range terms {
+		match[t] = true
+	}
+
+	var segments []Segment
+	add := func(s string, m bool) {
+		if s == "" {
+			return
+		}
+		// Merge with the previous segment if that's of the same kind.
+		if n := len(segments); n > 0 && segments[n-1].Match == m {
+			segments[n-1].Text += s
+			return
+		}
+		segments = append(segments, Segment{Text: s, Match: m})
+	}
+
+	// Walk through the text word by word, keeping everything in between as it is.
+	start := -1
+	for i, r := range text + " " {
+		isWord := unicode.IsLetter(r) || unicode.IsDigit(r)
+		switch {
+		case isWord && start < 0:
+			start = i
+		case !isWord && start >= 0:
+			word := text[start:i]
+			add(word, match[strings.ToLower(word)])
+			start = -1
+		}
+		if !isWord && i < len(text) {
+			add(string(r), false)
+		}
+	}
+
+	return segments
+}
+
+// Snippet returns an excerpt of `text` of about `length` characters around the first of the `terms`
+// it contains (or from the start, if there's none), with the terms highlighted.
+// Whitespace is collapsed, and "…" marks where the text was cut.
+func Snippet(text string, terms []string, length int) []Segment {
+	text = strings.Join(strings.Fields(text), " ")
+	runes := []rune(text)
+	if len(runes) <= length {
+		return Highlight(text, terms)
+	}
+
+	// Find the first match, and start a little before it.
+	first := 0
+	for _, s := range Highlight(text, terms) {
+		if s.Match {
+			break
+		}
+		first += utf8.RuneCountInString(s.Text)
+	}
+	if first == len(runes) {
+		first = 0
+	}
+
+	start := max(0, first-length/4)
+	end := min(len(runes), start+length)
+	start = max(0, end-length)
+
+	// Don't cut words in half.
+	for start > 0 && !unicode.IsSpace(runes[start-1]) && start < first {
+		start++
+	}
+	for end < len(runes) && !unicode.IsSpace(runes[end]) && end > first+1 {
+		end--
+	}
+
+	excerpt := strings.TrimSpace(string(runes[start:end]))
+	if start > 0 {
+		excerpt = "… " + excerpt
+	}
+	if end < len(runes) {
+		excerpt += " …"
+	}
+	return Highlight(excerpt, terms)
+}
+
+// Words in a document's title count this many times as much as words in its content.
+const titleWeight = 3
+
+// Parameters of the Okapi BM25 ranking function.
+const (
+	k1 = 1.2
+	b  = 0.75
+)
+
+// An Index is an inverted index of documents (e.g. memos) with a title & content, identified by an ID.
+// It's safe for concurrent use.
+type Index struct {
+	mu       sync.RWMutex
+	postings map[string]map[int]float64 // term => document ID => (weighted) term frequency
+	lengths  map[int]float64            // document ID => (weighted) number of words
+	terms    map[int][]string           // document ID => its distinct terms
+	total    float64                    // sum of `lengths`
+}
+
+// NewIndex returns an empty index.
+func NewIndex() *Index {
+	return &Index{
+		postings: make(map[string]map[int]float64),
+		lengths:  make(map[int]float64),
+		terms:    make(map[int][]string),
+	}
+}
+
+// Add a document to the index, replacing the previous version if it's already there.
+func (ix *Index) Add(id int, title, content string) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	ix.remove(id)
+
+	freqs := make(map[string]float64)
+	for _, w := range words(title) {
+		freqs[w] += titleWeight
+	}
+	for _, w := range words(content) {
+		freqs[w]++
+	}
+
+	var length float64
+	for w, f := range freqs {
+		if ix.postings[w] == nil {
+			ix.postings[w] = make(map[int]float64)
+		}
+		ix.postings[w][id] = f
+		ix.terms[id] = append(ix.terms[id], w)
+		length += f
+	}
+	ix.lengths[id] = length
+	ix.total += length
+}
+
+// Remove a document from the index; does nothing if it isn't there.
+func (ix *Index) Remove(id int) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	ix.remove(id)
+}
+
+// N.B. The caller must hold the lock.
+func (ix *Index) remove(id int) {
+	length, ok := ix.lengths[id]
+	if !ok {
+		return
+	}
+
+	for _, w := range ix.terms[id] {
+		delete(ix.postings[w], id)
+		if len(ix.postings[w]) == 0 {
+			delete(ix.postings, w)
+		}
+	}
+	delete(ix.lengths, id)
+	delete(ix.terms, id)
+	ix.total -= length
+}
+
+// A Hit is a document matching a search, with its relevance (higher is better).
+type Hit struct {
+	ID    int
+	Score float64
+}
+
+// Search returns the documents containing every one of `terms`, most relevant (by BM25) first.
+func (ix *Index) Search(terms []string) []Hit {
+	if len(terms) == 0 {
+		return nil
+	}
+
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	n := float64(len(ix.lengths))
+	avgLength := ix.total / max(n, 1)
+
+	scores := make(map[int]float64)
+	for i, t := range terms {
+		docs := ix.postings[t]
+		idf := math.Log(1 + (n-float64(len(docs))+0.5)/(float64(len(docs))+0.5))
+
+		next := make(map[int]float64)
+		for id, f := range docs {
+			// Only keep documents which contained all the previous terms, too.
+			if _, ok := scores[id]; i > 0 && !ok {
+				continue
+			}
+			norm := f + k1*(1-b+b*ix.lengths[id]/avgLength)
+			next[id] = scores[id] + idf*f*(k1+1)/norm
+		}
+		scores = next
+	}
+
+	hits := make([]Hit, 0, len(scores))
+	for id, score := range scores {
+		hits = append(hits, Hit{ID: id, Score: score})
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score == hits[j].Score {
+			return hits[i].ID > hits[j].ID // newest first
+		}
+		return hits[i].Score > hits[j].Score
+	})
+	return hits
+}
@@ -0,0 +1,182 @@
+package search
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/heschmat/MemoBin/internal/assert"
+)
+
+// Render segments with the matches in brackets, e.g. "a [b] c", to make expectations easy to read.
+func render(segments []Segment) string {
+	var b strings.Builder
+	for _, s := range segments {
+		if s.Match {
+			b.WriteString("[" + s.Text + "]")
+		} else {
+			b.WriteString(s.Text)
+		}
+	}
+	return b.String()
+}
+
+func TestTerms(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{
+			name:  "Words",
+			query: "Hello World",
+			want:  "hello world",
+		},
+		{
+			name:  "Punctuation",
+			query: `"quoted" -excluded (grouped) prefix* a+b`,
+			want:  "quoted excluded grouped prefix a b",
+		},
+		{
+			name:  "Duplicates",
+			query: "go Go GO",
+			want:  "go",
+		},
+		{
+			name:  "Unicode",
+			query: "Crème brûlée, 2024",
+			want:  "crème brûlée 2024",
+		},
+		{
+			name:  "Empty",
+			query: " ?! ",
+			want:  "",
+		},
+		{
+			name:  "Too many",
+			query: "a b c d e f g h i j k l",
+			want:  "a b c d e f g h i j",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, strings.Join(Terms(tt.query), " "), tt.want)
+		})
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		terms []string
+		want  string
+	}{
+		{
+			name:  "Case-insensitive",
+			text:  "Go is fun; go, GO!",
+			terms: []string{"go"},
+			want:  "[Go] is fun; [go], [GO]!",
+		},
+		{
+			name:  "Whole words only",
+			text:  "going gone go",
+			terms: []string{"go"},
+			want:  "going gone [go]",
+		},
+		{
+			name:  "Adjacent matches",
+			text:  "hello world",
+			terms: []string{"hello", "world"},
+			want:  "[hello] [world]",
+		},
+		{
+			name:  "No match",
+			text:  "nothing here",
+			terms: []string{"missing"},
+			want:  "nothing here",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, render(Highlight(tt.text, tt.terms)), tt.want)
+		})
+	}
+
+	// Adjacent segments of the same kind are merged.
+	segments := Highlight("a b c", []string{"b"})
+	assert.Equal(t, len(segments), 3)
+}
+
+func TestSnippet(t *testing.T) {
+	long := strings.Repeat("lorem ipsum ", 20) + "needle " + strings.Repeat("dolor sit ", 20)
+
+	tests := []struct {
+		name   string
+		text   string
+		terms  []string
+		length int
+		want   string
+	}{
+		{
+			name:   "Short",
+			text:   "a  short\n\ntext",
+			terms:  []string{"short"},
+			length: 100,
+			want:   "a [short] text",
+		},
+		{
+			name:   "Around the match",
+			text:   long,
+			terms:  []string{"needle"},
+			length: 40,
+			want:   "… ipsum [needle] dolor sit dolor sit …",
+		},
+		{
+			name:   "No match",
+			text:   long,
+			terms:  []string{"missing"},
+			length: 20,
+			want:   "lorem ipsum lorem …",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, render(Snippet(tt.text, tt.terms, tt.length)), tt.want)
+		})
+	}
+}
+
+func TestIndex(t *testing.T) {
+	ix := NewIndex()
+	ix.Add(1, "Shopping list", "Bread, butter and marmalade.")
+	ix.Add(2, "Marmalade", "Oranges & sugar, boiled until the marmalade sets.")
+	ix.Add(3, "Weather", "Sunny.")
+
+	ids := func(terms ...string) string {
+		var ids []string
+		for _, hit := range ix.Search(terms) {
+			ids = append(ids, string(rune('0'+hit.ID)))
+		}
+		return strings.Join(ids, " ")
+	}
+
+	// Matches in the title rank higher.
+	assert.Equal(t, ids("marmalade"), "2 1")
+	// Every term must match.
+	assert.Equal(t, ids("marmalade", "sugar"), "2")
+	assert.Equal(t, ids("marmalade", "rain"), "")
+	assert.Equal(t, ids(), "")
+
+	// Adding a document again replaces it.
+	ix.Add(3, "Weather", "Rain, and marmalade sandwiches.")
+	assert.Equal(t, ids("rain"), "3")
+	assert.Equal(t, ids("sunny"), "")
+
+	ix.Remove(2)
+	ix.Remove(4)                             // not indexed
+	assert.Equal(t, ids("marmalade"), "3 1") // the shorter document first
+	assert.Equal(t, len(ix.postings["sugar"]), 0)
+}
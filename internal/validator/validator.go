@@ -17,6 +17,9 @@ type Validator struct {
 
 var EmailRX = regexp.MustCompile("^[a-zA-Z0-9.!#$%&'*+/=?^_`{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$")
 
+// Tags are lower-case words (letters & digits), optionally joined by single hyphens or underscores: e.g., "go", "web-dev".
+var TagRX = regexp.MustCompile(`^[\p{Ll}\p{Lo}\p{N}]+(?:[-_][\p{Ll}\p{Lo}\p{N}]+)*$`)
+
 // Retrun true if no error - field-specific or not - is registered.
 func (v *Validator) Valid() bool {
 	return len(v.FieldErrors) == 0 && len(v.NonFieldErrors) == 0
@@ -63,3 +66,7 @@ func MinChars(s string, n int) bool {
 func Matches(s string, rx *regexp.Regexp) bool {
 	return rx.MatchString(s)
 }
+
+func MaxCount[T any](vals []T, n int) bool {
+	return len(vals) <= n
+}
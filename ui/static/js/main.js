@@ -5,4 +5,89 @@ for (var i = 0; i < navLinks.length; i++) {
 		link.classList.add("live");
 		break;
 	}
-}
\ No newline at end of file
+}
+
+// Suggest tags while typing in the tags field of the memo form.
+// The suggestions complete the last tag, keeping the ones before it.
+var tagInput = document.querySelector("input[data-suggest]");
+if (tagInput) {
+	var tagList = document.getElementById(tagInput.getAttribute("list"));
+	var tagRequest = 0;
+
+	tagInput.addEventListener("input", function() {
+		var value = tagInput.value;
+		var start = Math.max(value.lastIndexOf(","), value.lastIndexOf(" ")) + 1;
+		var before = value.slice(0, start);
+		var prefix = value.slice(start).trim();
+		var request = ++tagRequest;
+
+		if (prefix == "") {
+			tagList.innerHTML = "";
+			return;
+		}
+
+		fetch(tagInput.getAttribute("data-suggest") + "?q=" + encodeURIComponent(prefix))
+			.then(function(response) { return response.json(); })
+			.then(function(tags) {
+				// Ignore answers to earlier requests, arriving after later ones.
+				if (request != tagRequest) {
+					return;
+				}
+				tagList.innerHTML = "";
+				for (var i = 0; i < tags.length; i++) {
+					var option = document.createElement("option");
+					option.value = before + tags[i];
+					tagList.appendChild(option);
+				}
+			})
+			.catch(function() {});
+	});
+}
+
+// Switch the content of the memo form between writing & a preview rendered by the server,
+// exactly the way the memo will be shown.
+var tabs = document.querySelectorAll(".tabs .tab");
+if (tabs.length > 0) {
+	var memoForm = tabs[0].closest("form");
+	var content = memoForm.querySelector("textarea[name=content]");
+	var preview = memoForm.querySelector(".preview");
+
+	var showTab = function(tab) {
+		for (var i = 0; i < tabs.length; i++) {
+			tabs[i].classList.toggle("active", tabs[i] == tab);
+		}
+		var previewing = tab.getAttribute("data-tab") == "preview";
+		content.hidden = previewing;
+		preview.hidden = !previewing;
+	};
+
+	for (var i = 0; i < tabs.length; i++) {
+		tabs[i].addEventListener("click", function(event) {
+			var tab = event.currentTarget;
+			if (tab.getAttribute("data-tab") != "preview") {
+				showTab(tab);
+				return;
+			}
+
+			// The form includes the CSRF token, so it can be posted as it is.
+			fetch(tab.getAttribute("data-preview"), {
+				method: "POST",
+				body: new URLSearchParams(new FormData(memoForm))
+			})
+				.then(function(response) {
+					if (!response.ok) {
+						throw new Error(response.statusText);
+					}
+					return response.text();
+				})
+				.then(function(html) {
+					preview.innerHTML = html;
+					showTab(tab);
+				})
+				.catch(function(err) {
+					preview.textContent = "The preview isn't available: " + err.message;
+					showTab(tab);
+				});
+		});
+	}
+}